@@ -0,0 +1,305 @@
+package consulacl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+type RequestBody struct {
+	Token       string   `json:"token"`
+	Endpoint    string   `json:"endpoint"`
+	Action      string   `json:"action"`
+	ID          string   `json:"id,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Policies    []string `json:"policies,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	TTL         string   `json:"ttl,omitempty"`
+	Local       bool     `json:"local,omitempty"`
+	Confirm     string   `json:"confirm,omitempty"`
+}
+
+// Token is a Consul ACL token, its SecretID is masked unless the token has
+// just been created or cloned.
+type Token struct {
+	AccessorID     string     `json:"accessorId"`
+	SecretID       string     `json:"secretId,omitempty"`
+	Description    string     `json:"description"`
+	Policies       []string   `json:"policies"`
+	Roles          []string   `json:"roles"`
+	Local          bool       `json:"local"`
+	CreateTime     time.Time  `json:"createTime"`
+	ExpirationTime *time.Time `json:"expirationTime,omitempty"`
+}
+
+type Payload struct {
+	Tokens   []Token                      `json:"tokens,omitempty"`
+	Token    *Token                       `json:"token,omitempty"`
+	Policies []*consul.ACLPolicyListEntry `json:"policies,omitempty"`
+	Policy   *consul.ACLPolicy            `json:"policy,omitempty"`
+	Roles    []*consul.ACLRole            `json:"roles,omitempty"`
+	Role     *consul.ACLRole              `json:"role,omitempty"`
+	Message  string                       `json:"message,omitempty"`
+}
+
+type Response struct {
+	Payload Payload             `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	switch rb.Action {
+	case "token-list", "", "policy-list", "role-list":
+	case "token-read", "token-clone", "token-delete":
+		if len(rb.ID) == 0 {
+			fmt.Println("empty id")
+			http.Error(w, "empty id, it must be the token AccessorID", http.StatusBadRequest)
+			return
+		}
+		if rb.Action == "token-delete" && rb.Confirm != rb.ID {
+			fmt.Println("token-delete not confirmed")
+			http.Error(w, fmt.Sprintf("token-delete must be confirmed with \"confirm\": %q", rb.ID), http.StatusBadRequest)
+			return
+		}
+	case "policy-read", "role-read":
+		if len(rb.ID) == 0 && len(rb.Name) == 0 {
+			fmt.Println("empty id and name")
+			http.Error(w, "empty id and name", http.StatusBadRequest)
+			return
+		}
+	case "token-create":
+		if len(rb.TTL) != 0 {
+			ttl, err = time.ParseDuration(rb.TTL)
+			if err != nil || ttl <= 0 {
+				fmt.Println("invalid ttl:", rb.TTL)
+				http.Error(w, fmt.Sprintf("invalid ttl %q", rb.TTL), http.StatusBadRequest)
+				return
+			}
+		}
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	conf := consul.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	if rb.Token != "" {
+		conf.Token = rb.Token
+	}
+
+	client, err := consul.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	acl := client.ACL()
+
+	payload := Payload{}
+	switch rb.Action {
+	case "token-list", "":
+		var list []*consul.ACLTokenListEntry
+		list, _, err = acl.TokenList(nil)
+		payload.Tokens = []Token{}
+		for _, t := range list {
+			payload.Tokens = append(payload.Tokens, Token{
+				AccessorID:     t.AccessorID,
+				Description:    t.Description,
+				Policies:       linkNames(t.Policies),
+				Roles:          linkNames(t.Roles),
+				Local:          t.Local,
+				CreateTime:     t.CreateTime,
+				ExpirationTime: t.ExpirationTime,
+			})
+		}
+		sort.Slice(payload.Tokens, func(i, j int) bool {
+			return payload.Tokens[i].CreateTime.Before(payload.Tokens[j].CreateTime)
+		})
+
+	case "token-read":
+		var token *consul.ACLToken
+		token, _, err = acl.TokenRead(rb.ID, nil)
+		if err == nil {
+			payload.Token = newToken(token, false)
+		}
+
+	case "token-create":
+		policies := []*consul.ACLTokenPolicyLink{}
+		for _, p := range rb.Policies {
+			policies = append(policies, &consul.ACLTokenPolicyLink{Name: p})
+		}
+		roles := []*consul.ACLTokenRoleLink{}
+		for _, r := range rb.Roles {
+			roles = append(roles, &consul.ACLTokenRoleLink{Name: r})
+		}
+		var token *consul.ACLToken
+		token, _, err = acl.TokenCreate(&consul.ACLToken{
+			Description:   rb.Description,
+			Policies:      policies,
+			Roles:         roles,
+			Local:         rb.Local,
+			ExpirationTTL: ttl,
+		}, nil)
+		if err == nil {
+			payload.Token = newToken(token, true)
+			payload.Message = fmt.Sprintf("Token %s created.", token.AccessorID)
+		}
+
+	case "token-clone":
+		var token *consul.ACLToken
+		token, _, err = acl.TokenClone(rb.ID, rb.Description, nil)
+		if err == nil {
+			payload.Token = newToken(token, true)
+			payload.Message = fmt.Sprintf("Token %s cloned to %s.", rb.ID, token.AccessorID)
+		}
+
+	case "token-delete":
+		_, err = acl.TokenDelete(rb.ID, nil)
+		payload.Message = fmt.Sprintf("Token %s deleted.", rb.ID)
+
+	case "policy-list":
+		payload.Policies, _, err = acl.PolicyList(nil)
+		if err == nil && payload.Policies == nil {
+			payload.Policies = []*consul.ACLPolicyListEntry{}
+		}
+		sort.Slice(payload.Policies, func(i, j int) bool {
+			return payload.Policies[i].Name < payload.Policies[j].Name
+		})
+
+	case "policy-read":
+		if len(rb.ID) != 0 {
+			payload.Policy, _, err = acl.PolicyRead(rb.ID, nil)
+		} else {
+			payload.Policy, _, err = acl.PolicyReadByName(rb.Name, nil)
+		}
+		if err == nil && payload.Policy == nil {
+			notFound(w, "policy", orDefault(rb.ID, rb.Name))
+			return
+		}
+
+	case "role-list":
+		payload.Roles, _, err = acl.RoleList(nil)
+		if err == nil && payload.Roles == nil {
+			payload.Roles = []*consul.ACLRole{}
+		}
+		sort.Slice(payload.Roles, func(i, j int) bool {
+			return payload.Roles[i].Name < payload.Roles[j].Name
+		})
+
+	case "role-read":
+		if len(rb.ID) != 0 {
+			payload.Role, _, err = acl.RoleRead(rb.ID, nil)
+		} else {
+			payload.Role, _, err = acl.RoleReadByName(rb.Name, nil)
+		}
+		if err == nil && payload.Role == nil {
+			notFound(w, "role", orDefault(rb.ID, rb.Name))
+			return
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error on %s: %s\n", orDefault(rb.Action, "token-list"), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Header.Get("Content-Type") == "text/plain" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(formatPayload(&payload)))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+// newToken keeps the SecretID in clear only when asked, that is right after
+// creating or cloning the token, the only time the caller needs it.
+func newToken(t *consul.ACLToken, showSecret bool) *Token {
+	secret := maskSecret(t.SecretID)
+	if showSecret {
+		secret = t.SecretID
+	}
+	return &Token{
+		AccessorID:     t.AccessorID,
+		SecretID:       secret,
+		Description:    t.Description,
+		Policies:       linkNames(t.Policies),
+		Roles:          linkNames(t.Roles),
+		Local:          t.Local,
+		CreateTime:     t.CreateTime,
+		ExpirationTime: t.ExpirationTime,
+	}
+}
+
+// maskSecret hides the whole SecretID, the AccessorID is there to tell
+// tokens apart.
+func maskSecret(secret string) string {
+	if len(secret) == 0 {
+		return ""
+	}
+	return "<hidden>"
+}
+
+func linkNames(links []*consul.ACLLink) []string {
+	names := []string{}
+	for _, l := range links {
+		names = append(names, l.Name)
+	}
+	return names
+}
+
+func notFound(w http.ResponseWriter, kind, id string) {
+	fmt.Printf("%s %s not found\n", kind, id)
+	http.Error(w, fmt.Sprintf("%s %s not found", kind, id), http.StatusNotFound)
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,96 @@
+package consulacl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ryanuber/columnize"
+)
+
+// formatPayload prints lists as tables and single tokens, policies and roles
+// as fields, like the `consul acl` commands do.
+func formatPayload(payload *Payload) string {
+	out := []string{}
+	switch {
+	case payload.Tokens != nil:
+		out = append(out, "AccessorID\tDescription\tPolicies\tRoles\tLocal\tExpires")
+		for _, t := range payload.Tokens {
+			out = append(out, fmt.Sprintf("%s\t%s\t%s\t%s\t%t\t%s", t.AccessorID, orDefault(t.Description, "-"), joinNames(t.Policies), joinNames(t.Roles), t.Local, expiration(t.ExpirationTime)))
+		}
+
+	case payload.Token != nil:
+		t := payload.Token
+		out = append(out,
+			fmt.Sprintf("AccessorID:\t%s", t.AccessorID),
+			fmt.Sprintf("SecretID:\t%s", t.SecretID),
+			fmt.Sprintf("Description:\t%s", t.Description),
+			fmt.Sprintf("Policies:\t%s", joinNames(t.Policies)),
+			fmt.Sprintf("Roles:\t%s", joinNames(t.Roles)),
+			fmt.Sprintf("Local:\t%t", t.Local),
+			fmt.Sprintf("Create Time:\t%s", t.CreateTime.Format(time.RFC3339)),
+			fmt.Sprintf("Expiration Time:\t%s", expiration(t.ExpirationTime)),
+		)
+
+	case payload.Policies != nil:
+		out = append(out, "ID\tName\tDescription\tDatacenters")
+		for _, p := range payload.Policies {
+			out = append(out, fmt.Sprintf("%s\t%s\t%s\t%s", p.ID, p.Name, orDefault(p.Description, "-"), joinNames(p.Datacenters)))
+		}
+
+	case payload.Policy != nil:
+		p := payload.Policy
+		out = append(out,
+			fmt.Sprintf("ID:\t%s", p.ID),
+			fmt.Sprintf("Name:\t%s", p.Name),
+			fmt.Sprintf("Description:\t%s", p.Description),
+			fmt.Sprintf("Datacenters:\t%s", joinNames(p.Datacenters)),
+		)
+		// rules are multiline, they are not part of the table
+		return formatColumns(out) + "\nRules:\n" + p.Rules + "\n"
+
+	case payload.Roles != nil:
+		out = append(out, "ID\tName\tDescription\tPolicies")
+		for _, r := range payload.Roles {
+			out = append(out, fmt.Sprintf("%s\t%s\t%s\t%s", r.ID, r.Name, orDefault(r.Description, "-"), joinNames(linkNames(r.Policies))))
+		}
+
+	case payload.Role != nil:
+		r := payload.Role
+		out = append(out,
+			fmt.Sprintf("ID:\t%s", r.ID),
+			fmt.Sprintf("Name:\t%s", r.Name),
+			fmt.Sprintf("Description:\t%s", r.Description),
+			fmt.Sprintf("Policies:\t%s", joinNames(linkNames(r.Policies))),
+		)
+	}
+
+	if len(payload.Message) != 0 && len(out) != 0 {
+		out = append([]string{payload.Message, ""}, out...)
+	} else if len(payload.Message) != 0 {
+		out = []string{payload.Message}
+	}
+	return formatColumns(out)
+}
+
+func formatColumns(out []string) string {
+	columnConf := columnize.DefaultConfig()
+	columnConf.Delim = "\t"
+	columnConf.Glue = "  "
+	columnConf.NoTrim = false
+	return columnize.Format(out, columnConf)
+}
+
+func joinNames(names []string) string {
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ", ")
+}
+
+func expiration(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,9 @@
+module github.com/efbar/more-serverless/consul-acl/consulacl
+
+go 1.16
+
+require (
+	github.com/hashicorp/consul/api v1.8.1
+	github.com/hashicorp/consul/sdk v0.7.0
+	github.com/ryanuber/columnize v2.1.2+incompatible
+)
@@ -0,0 +1,187 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	consulacl "github.com/efbar/more-serverless/consul-acl/consulacl"
+	consul "github.com/hashicorp/consul/api"
+	testutil "github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+)
+
+func TestFunc(t *testing.T) {
+
+	var server *testutil.TestServer
+	var err error
+	retry.RunWith(retry.ThreeTimes(), t, func(r *retry.R) {
+		server, err = testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+			c.LogLevel = "INFO"
+			c.NodeName = "testnode"
+			c.PrimaryDatacenter = "dc1"
+			c.ACL.Enabled = true
+			c.ACL.DefaultPolicy = "deny"
+			c.ACL.Tokens.Master = "root"
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err.Error())
+	}
+	defer server.Stop()
+	server.WaitForSerfCheck(t)
+
+	if server.Config.Bootstrap {
+		server.WaitForLeader(t)
+	}
+
+	conf := consul.DefaultConfig()
+	conf.Address = "http://" + server.HTTPAddr
+	conf.Token = "root"
+
+	client, err := consul.NewClient(conf)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	_, _, err = client.ACL().PolicyCreate(&consul.ACLPolicy{
+		Name:  "kv-read",
+		Rules: `key_prefix "" { policy = "read" }`,
+	}, nil)
+	if err != nil {
+		t.Fatalf("policy err: %v", err)
+	}
+
+	serve := func(contentType string, request map[string]interface{}) *httptest.ResponseRecorder {
+		request["endpoint"] = conf.Address
+		request["token"] = conf.Token
+
+		jsonBody, _ := json.Marshal(request)
+		req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+		req.Header.Set("Content-Type", contentType)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(consulacl.Serve)
+
+		handler.ServeHTTP(rr, req)
+
+		fmt.Printf("response body: \n%s\n", rr.Body)
+		return rr
+	}
+
+	tt := []struct {
+		contentType string
+		request     map[string]interface{}
+		status      int
+	}{
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "token-create", "policies": []string{"kv-read"}, "ttl": "soon"},
+			status:      http.StatusBadRequest,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "token-read"},
+			status:      http.StatusBadRequest,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "token-rotate"},
+			status:      http.StatusBadRequest,
+		},
+		{
+			contentType: "text/plain",
+			request:     map[string]interface{}{"action": "token-list"},
+			status:      http.StatusOK,
+		},
+		{
+			contentType: "text/plain",
+			request:     map[string]interface{}{"action": "policy-list"},
+			status:      http.StatusOK,
+		},
+		{
+			contentType: "text/plain",
+			request:     map[string]interface{}{"action": "policy-read", "name": "kv-read"},
+			status:      http.StatusOK,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "policy-read", "name": "missing"},
+			status:      http.StatusNotFound,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "role-list"},
+			status:      http.StatusOK,
+		},
+	}
+
+	for _, tr := range tt {
+		t.Log(tr.request)
+
+		rr := serve(tr.contentType, tr.request)
+
+		if status := rr.Code; status != tr.status {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, tr.status)
+		}
+	}
+
+	tokenResponse := func(rr *httptest.ResponseRecorder) consulacl.Token {
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		res := struct {
+			Payload consulacl.Payload `json:"payload"`
+		}{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatalf("can't parse response: %s", err)
+		}
+		if res.Payload.Token == nil {
+			t.Fatalf("no token in response")
+		}
+		return *res.Payload.Token
+	}
+
+	created := tokenResponse(serve("application/json", map[string]interface{}{
+		"action":      "token-create",
+		"description": "ci",
+		"policies":    []string{"kv-read"},
+		"ttl":         "1h",
+	}))
+	if len(created.SecretID) != 36 || created.ExpirationTime == nil {
+		t.Errorf("wrong created token: %+v", created)
+	}
+
+	read := tokenResponse(serve("application/json", map[string]interface{}{"action": "token-read", "id": created.AccessorID}))
+	if read.SecretID == created.SecretID || strings.Contains(read.SecretID, created.SecretID[:8]) {
+		t.Errorf("secret not masked: %s", read.SecretID)
+	}
+	if len(read.Policies) != 1 || read.Policies[0] != "kv-read" {
+		t.Errorf("wrong policies: %v", read.Policies)
+	}
+
+	cloned := tokenResponse(serve("application/json", map[string]interface{}{"action": "token-clone", "id": created.AccessorID, "description": "ci clone"}))
+	if cloned.AccessorID == created.AccessorID || cloned.Description != "ci clone" {
+		t.Errorf("wrong cloned token: %+v", cloned)
+	}
+
+	rr := serve("application/json", map[string]interface{}{"action": "token-delete", "id": created.AccessorID})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	rr = serve("application/json", map[string]interface{}{"action": "token-delete", "id": created.AccessorID, "confirm": created.AccessorID})
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if _, _, err := client.ACL().TokenRead(created.AccessorID, nil); err == nil {
+		t.Errorf("token %s not deleted", created.AccessorID)
+	}
+	if _, _, err := client.ACL().TokenRead(cloned.AccessorID, nil); err != nil {
+		t.Errorf("cloned token lost: %v", err)
+	}
+}
@@ -0,0 +1,12 @@
+package function
+
+import (
+	"net/http"
+
+	consulacl "github.com/efbar/more-serverless/consul-acl/consulacl"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+
+	consulacl.Serve(w, r)
+}
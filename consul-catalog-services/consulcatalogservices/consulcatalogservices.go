@@ -8,18 +8,30 @@ import (
 	"sort"
 	"strings"
 
+	consulwatch "github.com/efbar/more-serverless/consul-watch/consulwatch"
+	message "github.com/efbar/more-serverless/slack-message/slackmessage"
 	consul "github.com/hashicorp/consul/api"
 	"github.com/ryanuber/columnize"
 )
 
 type RequestBody struct {
-	Token    string `json:"token"`
-	Endpoint string `json:"endpoint"`
+	Token        string            `json:"token"`
+	Endpoint     string            `json:"endpoint"`
+	Service      string            `json:"service,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	NodeMeta     map[string]string `json:"nodeMeta,omitempty"`
+	Filter       string            `json:"filter,omitempty"`
+	Watch        bool              `json:"watch,omitempty"`
+	WatchTimeout string            `json:"watchTimeout,omitempty"`
+	SlackToken   string            `json:"slackToken,omitempty"`
+	SlackChannel string            `json:"slackChannel,omitempty"`
+	SlackEmoji   string            `json:"slackEmoji,omitempty"`
 }
 
 type Response struct {
-	Payload []SimpleService     `json:"payload"`
-	Headers map[string][]string `json:"headers"`
+	Payload   []SimpleService     `json:"payload"`
+	Instances []Instance          `json:"instances,omitempty"`
+	Headers   map[string][]string `json:"headers"`
 }
 
 type SimpleService struct {
@@ -27,6 +39,19 @@ type SimpleService struct {
 	Tags []string `json:"tags,omitempty"`
 }
 
+// Instance is a service instance as in `consul catalog nodes -service`, with
+// the aggregated status of its node and service checks.
+type Instance struct {
+	Node     string            `json:"node"`
+	ID       string            `json:"id"`
+	Address  string            `json:"address"`
+	Port     int               `json:"port"`
+	Tags     []string          `json:"tags,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+	NodeMeta map[string]string `json:"nodeMeta,omitempty"`
+	Health   string            `json:"health"`
+}
+
 func Serve(w http.ResponseWriter, r *http.Request) {
 	var input []byte
 
@@ -52,6 +77,13 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	watchTimeout, err := consulwatch.ParseWatchTimeout(rb.WatchTimeout)
+	if err != nil {
+		fmt.Println("invalid watchTimeout:", err.Error())
+		http.Error(w, fmt.Sprintf("invalid watchTimeout: %s", err), http.StatusBadRequest)
+		return
+	}
+
 	conf := consul.DefaultConfig()
 
 	conf.Address = rb.Endpoint
@@ -69,7 +101,69 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 
 	catalog := client.Catalog()
 
-	services, _, _ := catalog.Services(nil)
+	queryOptions := &consul.QueryOptions{
+		NodeMeta: rb.NodeMeta,
+		Filter:   rb.Filter,
+	}
+
+	if rb.Watch {
+		notify := func(e *consulwatch.Event) {
+			if len(rb.SlackToken) > 0 && len(rb.SlackChannel) > 0 {
+				slackNotification(&rb, e.String())
+			}
+		}
+		consulwatch.Watch(w, r, watchTimeout, watchFetch(client, &rb), notify, 0)
+		return
+	}
+
+	if len(rb.Service) != 0 {
+		instances, err := serviceInstances(client, &rb, queryOptions)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resBody := ""
+		if r.Header.Get("Content-Type") == "text/plain" {
+			out := []string{"Node\tID\tAddress\tPort\tHealth\tTags\tMeta"}
+			for _, i := range instances {
+				out = append(out, fmt.Sprintf("%s\t%s\t%s\t%d\t%s\t%s\t%s", i.Node, i.ID, i.Address, i.Port, i.Health, strings.Join(i.Tags, ","), formatMeta(i.Meta)))
+			}
+			columnConf := columnize.DefaultConfig()
+			columnConf.Delim = "\t"
+			columnConf.Glue = "      "
+			columnConf.NoTrim = false
+			resBody = columnize.Format(out, columnConf)
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(resBody))
+		} else {
+			jsonResponse := Response{
+				Instances: instances,
+				Headers:   r.Header,
+			}
+			resBody, err := json.Marshal(jsonResponse)
+			if err != nil {
+				fmt.Println(err.Error())
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Write(resBody)
+		}
+		return
+	}
+
+	services, _, err := catalog.Services(queryOptions)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for k, v := range services {
+		if !hasTags(v, rb.Tags) {
+			delete(services, k)
+		}
+	}
 
 	resBody := ""
 	if r.Header.Get("Content-Type") == "text/plain" {
@@ -110,3 +204,125 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+// serviceInstances returns the instances of rb.Service having all rb.Tags,
+// the health of each one being aggregated from its node and service checks.
+func serviceInstances(client *consul.Client, rb *RequestBody, queryOptions *consul.QueryOptions) ([]Instance, error) {
+	services, _, err := client.Catalog().ServiceMultipleTags(rb.Service, rb.Tags, queryOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// health entries carry both the node and the service checks
+	entries, _, err := client.Health().Service(rb.Service, "", false, nil)
+	if err != nil {
+		return nil, err
+	}
+	checks := map[string]consul.HealthChecks{}
+	for _, e := range entries {
+		checks[e.Node.Node+"/"+e.Service.ID] = e.Checks
+	}
+
+	instances := []Instance{}
+	for _, s := range services {
+		address := s.ServiceAddress
+		if len(address) == 0 {
+			address = s.Address
+		}
+		instances = append(instances, Instance{
+			Node:     s.Node,
+			ID:       s.ServiceID,
+			Address:  address,
+			Port:     s.ServicePort,
+			Tags:     s.ServiceTags,
+			Meta:     s.ServiceMeta,
+			NodeMeta: s.NodeMeta,
+			Health:   checks[s.Node+"/"+s.ServiceID].AggregatedStatus(),
+		})
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Node != instances[j].Node {
+			return instances[i].Node < instances[j].Node
+		}
+		return instances[i].ID < instances[j].ID
+	})
+	return instances, nil
+}
+
+// hasTags tells whether tags contains every one of wanted.
+func hasTags(tags, wanted []string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, t := range tags {
+			if t == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func formatMeta(meta map[string]string) string {
+	pairs := []string{}
+	for k, v := range meta {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// watchFetch returns the blocking query for the services, or for the
+// instances of rb.Service: the health endpoint index changes with both the
+// catalog and the checks of the service.
+func watchFetch(client *consul.Client, rb *RequestBody) consulwatch.FetchFunc {
+	if len(rb.Service) == 0 {
+		return func(q *consul.QueryOptions) (map[string]string, uint64, error) {
+			q.NodeMeta = rb.NodeMeta
+			q.Filter = rb.Filter
+			services, meta, err := client.Catalog().Services(q)
+			if err != nil {
+				return nil, 0, err
+			}
+			state := map[string]string{}
+			for k, v := range services {
+				if hasTags(v, rb.Tags) {
+					state[k] = strings.Join(v, ",")
+				}
+			}
+			return state, meta.LastIndex, nil
+		}
+	}
+
+	return func(q *consul.QueryOptions) (map[string]string, uint64, error) {
+		_, meta, err := client.Health().Service(rb.Service, "", false, q)
+		if err != nil {
+			return nil, 0, err
+		}
+		instances, err := serviceInstances(client, rb, &consul.QueryOptions{NodeMeta: rb.NodeMeta, Filter: rb.Filter})
+		if err != nil {
+			return nil, 0, err
+		}
+		state := map[string]string{}
+		for _, i := range instances {
+			state[i.Node+"/"+i.ID] = fmt.Sprintf("%s:%d %s", i.Address, i.Port, i.Health)
+		}
+		return state, meta.LastIndex, nil
+	}
+}
+
+func slackNotification(rb *RequestBody, resBody string) {
+	slackToken := rb.SlackToken
+	slackChannelID := rb.SlackChannel
+	slackEmoji := rb.SlackEmoji
+	slackMessage := "Consul catalog changes " + slackEmoji + "\n```" + resBody + "```"
+
+	sent, err := message.Send(slackToken, slackMessage, slackChannelID)
+	if err != nil {
+		fmt.Printf("slack error: %s\n", err)
+	}
+	fmt.Println(sent)
+}
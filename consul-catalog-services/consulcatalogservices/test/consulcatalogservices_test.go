@@ -1,14 +1,18 @@
 package testing
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	consulcatalogservices "github.com/efbar/more-serverless/consul-catalog-services/consulcatalogservices"
+	consulwatch "github.com/efbar/more-serverless/consul-watch/consulwatch"
 	consul "github.com/hashicorp/consul/api"
 	testutil "github.com/hashicorp/consul/sdk/testutil"
 	"github.com/hashicorp/consul/sdk/testutil/retry"
@@ -20,6 +24,9 @@ func TestFunc(t *testing.T) {
 		aclenabled  bool
 		loglevel    string
 		contentType string
+		service     string
+		tags        []string
+		instances   int
 	}{
 		{
 			aclenabled:  true,
@@ -31,6 +38,27 @@ func TestFunc(t *testing.T) {
 			loglevel:    "INFO",
 			contentType: "application/json",
 		},
+		{
+			aclenabled:  true,
+			loglevel:    "INFO",
+			contentType: "text/plain",
+			service:     "foo",
+		},
+		{
+			aclenabled:  true,
+			loglevel:    "INFO",
+			contentType: "application/json",
+			service:     "foo",
+			tags:        []string{"bar", "buzz"},
+			instances:   1,
+		},
+		{
+			aclenabled:  true,
+			loglevel:    "INFO",
+			contentType: "application/json",
+			service:     "foo",
+			tags:        []string{"missing"},
+		},
 	}
 
 	for _, tr := range tt {
@@ -65,6 +93,8 @@ func TestFunc(t *testing.T) {
 
 		jsonStruct := map[string]interface{}{
 			"endpoint": conf.Address,
+			"service":  tr.service,
+			"tags":     tr.tags,
 		}
 
 		// here acl token part
@@ -87,6 +117,9 @@ func TestFunc(t *testing.T) {
 			agent_prefix "" {
 				policy = "read"
 			}
+			service_prefix "" {
+				policy = "read"
+			}
 			operator = "read"`,
 				Datacenters: []string{"dc1"},
 			}, nil)
@@ -123,6 +156,8 @@ func TestFunc(t *testing.T) {
 			Name: "foo",
 			ID:   "foobar1",
 			Tags: []string{"bar", "buzz", "fuzz"},
+			Port: 8080,
+			Meta: map[string]string{"version": "1.0"},
 		}
 		agent.ServiceRegister(reg)
 		defer agent.ServiceDeregister("foobar1")
@@ -142,7 +177,94 @@ func TestFunc(t *testing.T) {
 				status, http.StatusOK)
 		}
 
+		if len(tr.service) != 0 && tr.contentType == "application/json" {
+			res := consulcatalogservices.Response{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("can't parse response: %s", err)
+			}
+			if len(res.Instances) != tr.instances {
+				t.Errorf("wrong number of instances: got %d want %d", len(res.Instances), tr.instances)
+			}
+			for _, i := range res.Instances {
+				if i.Port != 8080 || i.Meta["version"] != "1.0" || i.Health != consul.HealthPassing {
+					t.Errorf("wrong instance: %+v", i)
+				}
+			}
+		}
+
 		fmt.Printf("response body: \n%s\n", rr.Body)
 	}
 
 }
+
+func TestWatch(t *testing.T) {
+
+	var server *testutil.TestServer
+	var err error
+	retry.RunWith(retry.ThreeTimes(), t, func(r *retry.R) {
+		server, err = testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+			c.LogLevel = "INFO"
+			c.NodeName = "testnode"
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err.Error())
+	}
+	defer server.Stop()
+	server.WaitForSerfCheck(t)
+
+	conf := consul.DefaultConfig()
+	conf.Address = "http://" + server.HTTPAddr
+
+	client, err := consul.NewClient(conf)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	agent := client.Agent()
+
+	reg := &consul.AgentServiceRegistration{
+		Name:  "foo",
+		ID:    "foobar1",
+		Port:  8080,
+		Check: &consul.AgentServiceCheck{CheckID: "foo-ttl", TTL: "10m", Status: consul.HealthPassing},
+	}
+	if err := agent.ServiceRegister(reg); err != nil {
+		t.Fatalf("register err: %v", err)
+	}
+	defer agent.ServiceDeregister("foobar1")
+
+	// only the health index moves when a check fails, the instances must be
+	// read again once the blocking query on it returns
+	go func() {
+		time.Sleep(time.Second)
+		agent.UpdateTTL("foo-ttl", "connection refused", consul.HealthCritical)
+	}()
+
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"endpoint":     conf.Address,
+		"service":      "foo",
+		"watch":        true,
+		"watchTimeout": "3s",
+	})
+	req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(consulcatalogservices.Serve).ServeHTTP(rr, req)
+
+	events := []consulwatch.Event{}
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		e := consulwatch.Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("can't parse event: %s", err)
+		}
+		events = append(events, e)
+	}
+	fmt.Printf("events: \n%+v\n", events)
+	if len(events) != 3 || events[0].Type != "snapshot" || events[1].Type != "change" || events[2].Type != "end" {
+		t.Fatalf("wrong events: %+v", events)
+	}
+	c, ok := events[1].Changed["testnode/foobar1"]
+	if !ok || !strings.HasSuffix(c.From, consul.HealthPassing) || !strings.HasSuffix(c.To, consul.HealthCritical) {
+		t.Errorf("wrong change: %+v", events[1])
+	}
+}
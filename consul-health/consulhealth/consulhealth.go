@@ -0,0 +1,327 @@
+package consulhealth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	consulwatch "github.com/efbar/more-serverless/consul-watch/consulwatch"
+	message "github.com/efbar/more-serverless/slack-message/slackmessage"
+	consul "github.com/hashicorp/consul/api"
+	"github.com/ryanuber/columnize"
+)
+
+// outputs longer than this are cut, they are meant to be a hint
+const maxOutput = 120
+
+type RequestBody struct {
+	Token        string `json:"token"`
+	Endpoint     string `json:"endpoint"`
+	State        string `json:"state,omitempty"`
+	Service      string `json:"service,omitempty"`
+	Node         string `json:"node,omitempty"`
+	Filter       string `json:"filter,omitempty"`
+	Watch        bool   `json:"watch,omitempty"`
+	WatchTimeout string `json:"watchTimeout,omitempty"`
+	SlackToken   string `json:"slackToken,omitempty"`
+	SlackChannel string `json:"slackChannel,omitempty"`
+	SlackEmoji   string `json:"slackEmoji,omitempty"`
+}
+
+type Check struct {
+	Node    string `json:"node"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Service string `json:"service,omitempty"`
+	Output  string `json:"output,omitempty"`
+}
+
+type Summary struct {
+	Total    int      `json:"total"`
+	Passing  int      `json:"passing"`
+	Warning  int      `json:"warning"`
+	Critical int      `json:"critical"`
+	Status   string   `json:"status"`
+	Nodes    []string `json:"failingNodes,omitempty"`
+	Services []string `json:"failingServices,omitempty"`
+}
+
+type Payload struct {
+	Summary Summary `json:"summary"`
+	Checks  []Check `json:"checks"`
+}
+
+type Response struct {
+	Payload Payload             `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+var statusOrder = map[string]int{
+	consul.HealthCritical: 0,
+	consul.HealthWarning:  1,
+	consul.HealthPassing:  2,
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	switch rb.State {
+	case "":
+		rb.State = consul.HealthAny
+	case consul.HealthAny, consul.HealthPassing, consul.HealthWarning, consul.HealthCritical:
+	default:
+		fmt.Println("unknown state:", rb.State)
+		http.Error(w, fmt.Sprintf("unknown state %q", rb.State), http.StatusBadRequest)
+		return
+	}
+
+	watchTimeout, err := consulwatch.ParseWatchTimeout(rb.WatchTimeout)
+	if err != nil {
+		fmt.Println("invalid watchTimeout:", err.Error())
+		http.Error(w, fmt.Sprintf("invalid watchTimeout: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	conf := consul.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	if rb.Token != "" {
+		conf.Token = rb.Token
+	}
+
+	client, err := consul.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rb.Watch {
+		notify := func(e *consulwatch.Event) {
+			if len(rb.SlackToken) > 0 && len(rb.SlackChannel) > 0 {
+				slackNotification(&rb, e.String())
+			}
+		}
+		fetch := func(q *consul.QueryOptions) (map[string]string, uint64, error) {
+			checks, index, err := healthChecks(client, &rb, q)
+			if err != nil {
+				return nil, 0, err
+			}
+			state := map[string]string{}
+			for _, c := range checks {
+				state[c.Node+"/"+c.ID] = c.Status
+			}
+			return state, index, nil
+		}
+		consulwatch.Watch(w, r, watchTimeout, fetch, notify, 0)
+		return
+	}
+
+	checks, _, err := healthChecks(client, &rb, &consul.QueryOptions{})
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	payload := Payload{
+		Summary: summarize(checks),
+		Checks:  checks,
+	}
+
+	resBody := formatPayload(&payload)
+	if len(rb.SlackToken) > 0 && len(rb.SlackChannel) > 0 {
+		slackNotification(&rb, resBody)
+	}
+
+	if r.Header.Get("Content-Type") == "text/plain" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+// healthChecks returns the checks of a service, of a node, of a service on a
+// node, or every check in the requested state, worst first, with the index
+// to block on for changes.
+func healthChecks(client *consul.Client, rb *RequestBody, queryOptions *consul.QueryOptions) ([]Check, uint64, error) {
+	health := client.Health()
+	queryOptions.Filter = rb.Filter
+
+	var list consul.HealthChecks
+	var meta *consul.QueryMeta
+	var err error
+	switch {
+	case len(rb.Node) != 0:
+		list, meta, err = health.Node(rb.Node, queryOptions)
+	case len(rb.Service) != 0:
+		list, meta, err = health.Checks(rb.Service, queryOptions)
+	default:
+		list, meta, err = health.State(rb.State, queryOptions)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	checks := []Check{}
+	for _, c := range list {
+		if len(rb.Service) != 0 && c.ServiceName != rb.Service {
+			continue
+		}
+		if rb.State != consul.HealthAny && c.Status != rb.State {
+			continue
+		}
+		checks = append(checks, Check{
+			Node:    c.Node,
+			ID:      c.CheckID,
+			Name:    c.Name,
+			Status:  c.Status,
+			Service: c.ServiceName,
+			Output:  snippet(c.Output),
+		})
+	}
+
+	sort.Slice(checks, func(i, j int) bool {
+		if checks[i].Status != checks[j].Status {
+			return statusOrder[checks[i].Status] < statusOrder[checks[j].Status]
+		}
+		if checks[i].Node != checks[j].Node {
+			return checks[i].Node < checks[j].Node
+		}
+		return checks[i].ID < checks[j].ID
+	})
+	return checks, meta.LastIndex, nil
+}
+
+func summarize(checks []Check) Summary {
+	summary := Summary{Total: len(checks), Status: consul.HealthPassing}
+	nodes := map[string]bool{}
+	services := map[string]bool{}
+	for _, c := range checks {
+		switch c.Status {
+		case consul.HealthPassing:
+			summary.Passing++
+		case consul.HealthWarning:
+			summary.Warning++
+		case consul.HealthCritical:
+			summary.Critical++
+		}
+		if c.Status == consul.HealthPassing {
+			continue
+		}
+		if len(c.Service) != 0 {
+			services[c.Service] = true
+		} else {
+			nodes[c.Node] = true
+		}
+	}
+
+	switch {
+	case summary.Critical > 0:
+		summary.Status = consul.HealthCritical
+	case summary.Warning > 0:
+		summary.Status = consul.HealthWarning
+	}
+	for n := range nodes {
+		summary.Nodes = append(summary.Nodes, n)
+	}
+	sort.Strings(summary.Nodes)
+	for s := range services {
+		summary.Services = append(summary.Services, s)
+	}
+	sort.Strings(summary.Services)
+	return summary
+}
+
+// snippet returns the first line of a check output, cut to maxOutput.
+func snippet(output string) string {
+	output = strings.TrimSpace(output)
+	if i := strings.IndexByte(output, '\n'); i >= 0 {
+		output = strings.TrimSpace(output[:i]) + " ..."
+	}
+	if len(output) > maxOutput {
+		output = output[:maxOutput] + " ..."
+	}
+	return output
+}
+
+func formatPayload(payload *Payload) string {
+	out := []string{"Status\tNode\tService\tCheck\tOutput"}
+	for _, c := range payload.Checks {
+		out = append(out, fmt.Sprintf("%s\t%s\t%s\t%s\t%s", c.Status, c.Node, orNone(c.Service), c.Name, c.Output))
+	}
+
+	s := payload.Summary
+	out = append(out, "")
+	out = append(out, fmt.Sprintf("Summary\t%s: %d checks, %d passing, %d warning, %d critical", s.Status, s.Total, s.Passing, s.Warning, s.Critical))
+	if len(s.Nodes) != 0 {
+		out = append(out, fmt.Sprintf("Failing nodes\t%s", strings.Join(s.Nodes, ", ")))
+	}
+	if len(s.Services) != 0 {
+		out = append(out, fmt.Sprintf("Failing services\t%s", strings.Join(s.Services, ", ")))
+	}
+
+	columnConf := columnize.DefaultConfig()
+	columnConf.Delim = "\t"
+	columnConf.Glue = "  "
+	columnConf.NoTrim = false
+	return columnize.Format(out, columnConf)
+}
+
+func orNone(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+func slackNotification(rb *RequestBody, resBody string) {
+	slackToken := rb.SlackToken
+	slackChannelID := rb.SlackChannel
+	slackEmoji := rb.SlackEmoji
+	slackMessage := "Consul health " + slackEmoji + "\n```" + resBody + "```"
+
+	sent, err := message.Send(slackToken, slackMessage, slackChannelID)
+	if err != nil {
+		fmt.Printf("slack error: %s\n", err)
+	}
+	fmt.Println(sent)
+}
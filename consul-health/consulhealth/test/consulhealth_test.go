@@ -0,0 +1,262 @@
+package testing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	consulhealth "github.com/efbar/more-serverless/consul-health/consulhealth"
+	consulwatch "github.com/efbar/more-serverless/consul-watch/consulwatch"
+	consul "github.com/hashicorp/consul/api"
+	testutil "github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+)
+
+func TestFunc(t *testing.T) {
+
+	tt := []struct {
+		aclenabled  bool
+		loglevel    string
+		contentType string
+		state       string
+		service     string
+		checks      int
+		status      string
+	}{
+		{
+			aclenabled:  true,
+			loglevel:    "INFO",
+			contentType: "text/plain",
+		},
+		{
+			aclenabled:  true,
+			loglevel:    "INFO",
+			contentType: "application/json",
+			service:     "foo",
+			checks:      2,
+			status:      consul.HealthCritical,
+		},
+		{
+			aclenabled:  true,
+			loglevel:    "INFO",
+			contentType: "application/json",
+			state:       consul.HealthWarning,
+			checks:      1,
+			status:      consul.HealthWarning,
+		},
+	}
+
+	for _, tr := range tt {
+
+		var server *testutil.TestServer
+		var err error
+		retry.RunWith(retry.ThreeTimes(), t, func(r *retry.R) {
+			server, err = testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+				c.LogLevel = tr.loglevel
+				c.NodeName = "testnode"
+				if tr.aclenabled {
+					c.ACL.Enabled = tr.aclenabled
+					c.PrimaryDatacenter = "dc1"
+					c.ACL.Tokens.Master = "root"
+					c.ACL.Tokens.Agent = "root"
+					c.ACL.DefaultPolicy = "deny"
+				}
+			})
+		})
+		if err != nil {
+			t.Fatalf("Failed to start server: %v", err.Error())
+		}
+		defer server.Stop()
+		server.WaitForSerfCheck(t)
+
+		if server.Config.Bootstrap {
+			server.WaitForLeader(t)
+		}
+
+		conf := consul.DefaultConfig()
+		conf.Address = "http://" + server.HTTPAddr
+
+		jsonStruct := map[string]interface{}{
+			"endpoint": conf.Address,
+			"service":  tr.service,
+			"state":    tr.state,
+		}
+
+		// here acl token part
+		if server.Config.ACL.Enabled {
+			conf.Token = "root"
+
+			client, err := consul.NewClient(conf)
+			if err != nil {
+				t.Fatalf("acl err: %v", err)
+			}
+
+			acl := client.ACL()
+
+			created, _, err := acl.PolicyCreate(&consul.ACLPolicy{
+				Name:        "test-policy",
+				Description: "test-policy description",
+				Rules: `node_prefix "" { 
+				policy = "read" 
+			}
+			agent_prefix "" {
+				policy = "read"
+			}
+			service_prefix "" {
+				policy = "read"
+			}
+			operator = "read"`,
+				Datacenters: []string{"dc1"},
+			}, nil)
+			if err != nil {
+				t.Fatalf("policy err: %v", err)
+			}
+
+			tokenTest, _, err := acl.TokenCreate(&consul.ACLToken{
+				Description: created.Description + " token",
+				Policies: []*consul.ACLTokenPolicyLink{
+					{
+						ID: created.ID,
+					},
+				},
+			}, nil)
+			if err != nil {
+				t.Fatalf("token creation err: %v", err)
+			}
+
+			t.Log("created token:", tokenTest.SecretID)
+			t.Log("created policies:", tokenTest.Policies[0].ID)
+
+			jsonStruct["token"] = tokenTest.SecretID
+
+		}
+
+		client, err := consul.NewClient(conf)
+		if err != nil {
+			t.Fatalf("acl err: %v", err)
+		}
+		agent := client.Agent()
+
+		reg := &consul.AgentServiceRegistration{
+			Name: "foo",
+			ID:   "foobar1",
+			Checks: consul.AgentServiceChecks{
+				{CheckID: "foo-warn", TTL: "10m"},
+				{CheckID: "foo-fail", TTL: "10m"},
+			},
+		}
+		agent.ServiceRegister(reg)
+		defer agent.ServiceDeregister("foobar1")
+
+		if err := agent.UpdateTTL("foo-warn", "slow responses", consul.HealthWarning); err != nil {
+			t.Fatalf("ttl update err: %v", err)
+		}
+		if err := agent.UpdateTTL("foo-fail", "connection refused\nretrying", consul.HealthCritical); err != nil {
+			t.Fatalf("ttl update err: %v", err)
+		}
+
+		jsonBody, _ := json.Marshal(jsonStruct)
+		req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+		req.Header.Set("Content-Type", tr.contentType)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(consulhealth.Serve)
+
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, http.StatusOK)
+		}
+
+		if tr.contentType == "application/json" {
+			res := consulhealth.Response{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("can't parse response: %s", err)
+			}
+			if len(res.Payload.Checks) != tr.checks {
+				t.Errorf("wrong number of checks: got %d want %d", len(res.Payload.Checks), tr.checks)
+			}
+			if res.Payload.Summary.Status != tr.status {
+				t.Errorf("wrong summary status: got %s want %s", res.Payload.Summary.Status, tr.status)
+			}
+		}
+
+		fmt.Printf("response body: \n%s\n", rr.Body)
+	}
+
+}
+
+func TestWatch(t *testing.T) {
+
+	var server *testutil.TestServer
+	var err error
+	retry.RunWith(retry.ThreeTimes(), t, func(r *retry.R) {
+		server, err = testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+			c.LogLevel = "INFO"
+			c.NodeName = "testnode"
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err.Error())
+	}
+	defer server.Stop()
+	server.WaitForSerfCheck(t)
+
+	conf := consul.DefaultConfig()
+	conf.Address = "http://" + server.HTTPAddr
+
+	client, err := consul.NewClient(conf)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	agent := client.Agent()
+
+	reg := &consul.AgentServiceRegistration{
+		Name:  "foo",
+		ID:    "foobar1",
+		Check: &consul.AgentServiceCheck{CheckID: "foo-ttl", TTL: "10m", Status: consul.HealthPassing},
+	}
+	if err := agent.ServiceRegister(reg); err != nil {
+		t.Fatalf("register err: %v", err)
+	}
+	defer agent.ServiceDeregister("foobar1")
+
+	go func() {
+		time.Sleep(time.Second)
+		agent.UpdateTTL("foo-ttl", "slow responses", consul.HealthWarning)
+	}()
+
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"endpoint":     conf.Address,
+		"service":      "foo",
+		"watch":        true,
+		"watchTimeout": "3s",
+	})
+	req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(consulhealth.Serve).ServeHTTP(rr, req)
+
+	events := []consulwatch.Event{}
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		e := consulwatch.Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("can't parse event: %s", err)
+		}
+		events = append(events, e)
+	}
+	fmt.Printf("events: \n%+v\n", events)
+	if len(events) != 3 || events[0].Type != "snapshot" || events[1].Type != "change" || events[2].Type != "end" {
+		t.Fatalf("wrong events: %+v", events)
+	}
+	if c := events[1].Changed["testnode/foo-ttl"]; c.From != consul.HealthPassing || c.To != consul.HealthWarning {
+		t.Errorf("wrong change: %+v", events[1])
+	}
+}
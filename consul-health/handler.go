@@ -0,0 +1,12 @@
+package function
+
+import (
+	"net/http"
+
+	consulhealth "github.com/efbar/more-serverless/consul-health/consulhealth"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+
+	consulhealth.Serve(w, r)
+}
@@ -0,0 +1,389 @@
+package consulkv
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	consulwatch "github.com/efbar/more-serverless/consul-watch/consulwatch"
+	message "github.com/efbar/more-serverless/slack-message/slackmessage"
+	consul "github.com/hashicorp/consul/api"
+	"github.com/ryanuber/columnize"
+)
+
+// values longer than this are cut in watch events
+const maxValue = 120
+
+type RequestBody struct {
+	Token        string  `json:"token"`
+	Endpoint     string  `json:"endpoint"`
+	Action       string  `json:"action"`
+	Key          string  `json:"key"`
+	Value        string  `json:"value,omitempty"`
+	Flags        uint64  `json:"flags,omitempty"`
+	Cas          *uint64 `json:"cas,omitempty"`
+	Recursive    bool    `json:"recursive,omitempty"`
+	Confirm      string  `json:"confirm,omitempty"`
+	Data         []Entry `json:"data,omitempty"`
+	Watch        bool    `json:"watch,omitempty"`
+	WatchTimeout string  `json:"watchTimeout,omitempty"`
+	SlackToken   string  `json:"slackToken,omitempty"`
+	SlackChannel string  `json:"slackChannel,omitempty"`
+	SlackEmoji   string  `json:"slackEmoji,omitempty"`
+}
+
+// Entry is the format of `consul kv export` and `consul kv import`, the
+// value being base64 encoded.
+type Entry struct {
+	Key   string `json:"key"`
+	Flags uint64 `json:"flags"`
+	Value string `json:"value"`
+}
+
+type Pair struct {
+	Key         string `json:"key"`
+	Value       string `json:"value,omitempty"`
+	Flags       uint64 `json:"flags"`
+	CreateIndex uint64 `json:"createIndex"`
+	ModifyIndex uint64 `json:"modifyIndex"`
+	Session     string `json:"session,omitempty"`
+}
+
+type Payload struct {
+	Pair     *Pair   `json:"pair,omitempty"`
+	Pairs    []Pair  `json:"pairs,omitempty"`
+	Entries  []Entry `json:"entries,omitempty"`
+	Imported int     `json:"imported,omitempty"`
+	Message  string  `json:"message,omitempty"`
+}
+
+type Response struct {
+	Payload Payload             `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	switch rb.Action {
+	case "get", "", "put":
+		if len(rb.Key) == 0 {
+			fmt.Println("empty key")
+			http.Error(w, "empty key", http.StatusBadRequest)
+			return
+		}
+	case "delete":
+		if len(rb.Key) == 0 && !rb.Recursive {
+			fmt.Println("empty key")
+			http.Error(w, "empty key", http.StatusBadRequest)
+			return
+		}
+		// deleting a whole tree must name it again, "*" being the whole store
+		if expected := orDefault(rb.Key, "*"); rb.Recursive && rb.Confirm != expected {
+			fmt.Println("recursive delete not confirmed")
+			http.Error(w, fmt.Sprintf("recursive delete must be confirmed with \"confirm\": %q", expected), http.StatusBadRequest)
+			return
+		}
+	case "list", "export":
+	case "import":
+		if len(rb.Data) == 0 {
+			fmt.Println("empty data")
+			http.Error(w, "empty data", http.StatusBadRequest)
+			return
+		}
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	if rb.Watch && rb.Action != "get" && rb.Action != "" && rb.Action != "list" {
+		fmt.Println("watch on", rb.Action)
+		http.Error(w, "watch is only supported by get and list", http.StatusBadRequest)
+		return
+	}
+	watchTimeout, err := consulwatch.ParseWatchTimeout(rb.WatchTimeout)
+	if err != nil {
+		fmt.Println("invalid watchTimeout:", err.Error())
+		http.Error(w, fmt.Sprintf("invalid watchTimeout: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	conf := consul.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	if rb.Token != "" {
+		conf.Token = rb.Token
+	}
+
+	client, err := consul.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	kv := client.KV()
+
+	if rb.Watch {
+		notify := func(e *consulwatch.Event) {
+			if len(rb.SlackToken) > 0 && len(rb.SlackChannel) > 0 {
+				slackNotification(&rb, e.String())
+			}
+		}
+		consulwatch.Watch(w, r, watchTimeout, watchFetch(kv, &rb), notify, maxValue)
+		return
+	}
+
+	payload := Payload{}
+	switch rb.Action {
+	case "get", "":
+		var pair *consul.KVPair
+		pair, _, err = kv.Get(rb.Key, nil)
+		if err == nil && pair == nil {
+			fmt.Printf("key %s not found\n", rb.Key)
+			http.Error(w, fmt.Sprintf("key %s not found", rb.Key), http.StatusNotFound)
+			return
+		}
+		if err == nil {
+			p := newPair(pair)
+			payload.Pair = &p
+		}
+
+	case "put":
+		pair := &consul.KVPair{Key: rb.Key, Flags: rb.Flags, Value: []byte(rb.Value)}
+		if rb.Cas == nil {
+			_, err = kv.Put(pair, nil)
+			if err == nil {
+				payload.Message = fmt.Sprintf("Success! Data written to: %s", rb.Key)
+			}
+			break
+		}
+		pair.ModifyIndex = *rb.Cas
+		var ok bool
+		ok, _, err = kv.CAS(pair, nil)
+		if err == nil && !ok {
+			fmt.Printf("cas failed on %s\n", rb.Key)
+			http.Error(w, fmt.Sprintf("Error! Did not write to %s: CAS failed", rb.Key), http.StatusConflict)
+			return
+		}
+		if err == nil {
+			payload.Message = fmt.Sprintf("Success! Data written to: %s", rb.Key)
+		}
+
+	case "list":
+		var pairs consul.KVPairs
+		pairs, _, err = kv.List(rb.Key, nil)
+		payload.Pairs = []Pair{}
+		for _, pair := range pairs {
+			p := newPair(pair)
+			p.Value = ""
+			payload.Pairs = append(payload.Pairs, p)
+		}
+
+	case "delete":
+		switch {
+		case rb.Recursive:
+			_, err = kv.DeleteTree(rb.Key, nil)
+		case rb.Cas != nil:
+			var ok bool
+			ok, _, err = kv.DeleteCAS(&consul.KVPair{Key: rb.Key, ModifyIndex: *rb.Cas}, nil)
+			if err == nil && !ok {
+				fmt.Printf("cas failed on %s\n", rb.Key)
+				http.Error(w, fmt.Sprintf("Error! Did not delete key %s: CAS failed", rb.Key), http.StatusConflict)
+				return
+			}
+		default:
+			_, err = kv.Delete(rb.Key, nil)
+		}
+		if err == nil {
+			payload.Message = fmt.Sprintf("Success! Deleted key: %s", rb.Key)
+			if rb.Recursive {
+				payload.Message = fmt.Sprintf("Success! Deleted keys with prefix: %s", rb.Key)
+			}
+		}
+
+	case "export":
+		var pairs consul.KVPairs
+		pairs, _, err = kv.List(rb.Key, nil)
+		payload.Entries = []Entry{}
+		for _, pair := range pairs {
+			payload.Entries = append(payload.Entries, Entry{
+				Key:   pair.Key,
+				Flags: pair.Flags,
+				Value: base64.StdEncoding.EncodeToString(pair.Value),
+			})
+		}
+
+	case "import":
+		payload.Imported, err = importEntries(kv, rb.Key, rb.Data)
+		if err == nil {
+			payload.Message = fmt.Sprintf("Imported: %d keys", payload.Imported)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error on %s: %s\n", orDefault(rb.Action, "get"), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Header.Get("Content-Type") == "text/plain" {
+		resBody, err := formatPayload(&payload)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+func newPair(pair *consul.KVPair) Pair {
+	return Pair{
+		Key:         pair.Key,
+		Value:       string(pair.Value),
+		Flags:       pair.Flags,
+		CreateIndex: pair.CreateIndex,
+		ModifyIndex: pair.ModifyIndex,
+		Session:     pair.Session,
+	}
+}
+
+// importEntries writes every entry, with prefix prepended to its key like
+// `consul kv import -prefix`. Values are all decoded before anything is
+// written, so that a malformed entry doesn't leave a partial import.
+func importEntries(kv *consul.KV, prefix string, entries []Entry) (int, error) {
+	pairs := []*consul.KVPair{}
+	for _, e := range entries {
+		value, err := base64.StdEncoding.DecodeString(e.Value)
+		if err != nil {
+			return 0, fmt.Errorf("cannot base 64 decode value of %s: %s", e.Key, err)
+		}
+		pairs = append(pairs, &consul.KVPair{Key: prefix + e.Key, Flags: e.Flags, Value: value})
+	}
+
+	for i, pair := range pairs {
+		if _, err := kv.Put(pair, nil); err != nil {
+			return i, fmt.Errorf("error importing key %s: %s", pair.Key, err)
+		}
+	}
+	return len(pairs), nil
+}
+
+// formatPayload prints values raw like `consul kv get`, and the export in
+// the very format `consul kv import` reads.
+func formatPayload(payload *Payload) (string, error) {
+	switch {
+	case payload.Pair != nil:
+		return payload.Pair.Value + "\n", nil
+
+	case payload.Pairs != nil:
+		out := []string{"Key\tFlags\tCreate Index\tModify Index\tSession"}
+		for _, p := range payload.Pairs {
+			out = append(out, fmt.Sprintf("%s\t%d\t%d\t%d\t%s", p.Key, p.Flags, p.CreateIndex, p.ModifyIndex, orDefault(p.Session, "-")))
+		}
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "    "
+		columnConf.NoTrim = false
+		return columnize.Format(out, columnConf), nil
+
+	case payload.Entries != nil:
+		export, err := json.MarshalIndent(payload.Entries, "", "\t")
+		if err != nil {
+			return "", err
+		}
+		return string(export) + "\n", nil
+	}
+	return strings.TrimSpace(payload.Message) + "\n", nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// watchFetch returns the blocking query for a key, or for every key under a
+// prefix with list. The state holds the whole values, so that an edit past
+// maxValue is a change too.
+func watchFetch(kv *consul.KV, rb *RequestBody) consulwatch.FetchFunc {
+	if rb.Action == "list" {
+		return func(q *consul.QueryOptions) (map[string]string, uint64, error) {
+			pairs, meta, err := kv.List(rb.Key, q)
+			if err != nil {
+				return nil, 0, err
+			}
+			state := map[string]string{}
+			for _, pair := range pairs {
+				state[pair.Key] = string(pair.Value)
+			}
+			return state, meta.LastIndex, nil
+		}
+	}
+
+	return func(q *consul.QueryOptions) (map[string]string, uint64, error) {
+		pair, meta, err := kv.Get(rb.Key, q)
+		if err != nil {
+			return nil, 0, err
+		}
+		state := map[string]string{}
+		if pair != nil {
+			state[pair.Key] = string(pair.Value)
+		}
+		return state, meta.LastIndex, nil
+	}
+}
+
+func slackNotification(rb *RequestBody, resBody string) {
+	slackToken := rb.SlackToken
+	slackChannelID := rb.SlackChannel
+	slackEmoji := rb.SlackEmoji
+	slackMessage := "Consul KV changes under " + rb.Key + " " + slackEmoji + "\n```" + resBody + "```"
+
+	sent, err := message.Send(slackToken, slackMessage, slackChannelID)
+	if err != nil {
+		fmt.Printf("slack error: %s\n", err)
+	}
+	fmt.Println(sent)
+}
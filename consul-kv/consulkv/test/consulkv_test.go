@@ -0,0 +1,217 @@
+package testing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	consulkv "github.com/efbar/more-serverless/consul-kv/consulkv"
+	consulwatch "github.com/efbar/more-serverless/consul-watch/consulwatch"
+	consul "github.com/hashicorp/consul/api"
+	testutil "github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+)
+
+func TestFunc(t *testing.T) {
+
+	var server *testutil.TestServer
+	var err error
+	retry.RunWith(retry.ThreeTimes(), t, func(r *retry.R) {
+		server, err = testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+			c.LogLevel = "INFO"
+			c.NodeName = "testnode"
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err.Error())
+	}
+	defer server.Stop()
+	server.WaitForSerfCheck(t)
+
+	if server.Config.Bootstrap {
+		server.WaitForLeader(t)
+	}
+
+	conf := consul.DefaultConfig()
+	conf.Address = "http://" + server.HTTPAddr
+
+	client, err := consul.NewClient(conf)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	export := []consulkv.Entry{
+		{Key: "app/config/db", Value: "cG9zdGdyZXM="},
+		{Key: "app/config/cache", Flags: 42, Value: "cmVkaXM="},
+	}
+
+	var zero uint64
+	tt := []struct {
+		contentType string
+		request     map[string]interface{}
+		status      int
+	}{
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "put", "key": "app/name", "value": "foo"},
+			status:      http.StatusOK,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "put", "key": "app/name", "value": "bar", "cas": &zero},
+			status:      http.StatusConflict,
+		},
+		{
+			contentType: "text/plain",
+			request:     map[string]interface{}{"key": "app/name"},
+			status:      http.StatusOK,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"key": "app/missing"},
+			status:      http.StatusNotFound,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "import", "data": export},
+			status:      http.StatusOK,
+		},
+		{
+			contentType: "text/plain",
+			request:     map[string]interface{}{"action": "list", "key": "app/"},
+			status:      http.StatusOK,
+		},
+		{
+			contentType: "text/plain",
+			request:     map[string]interface{}{"action": "export", "key": "app/config/"},
+			status:      http.StatusOK,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "delete", "key": "app/", "recursive": true},
+			status:      http.StatusBadRequest,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "delete", "key": "app/config/", "recursive": true, "confirm": "app/config/"},
+			status:      http.StatusOK,
+		},
+	}
+
+	for _, tr := range tt {
+		t.Log(tr.request)
+
+		tr.request["endpoint"] = conf.Address
+
+		jsonBody, _ := json.Marshal(tr.request)
+		req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+		req.Header.Set("Content-Type", tr.contentType)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(consulkv.Serve)
+
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tr.status {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, tr.status)
+		}
+
+		fmt.Printf("response body: \n%s\n", rr.Body)
+	}
+
+	pair, _, err := client.KV().Get("app/name", nil)
+	if err != nil || pair == nil {
+		t.Fatalf("key not found: %v", err)
+	}
+	if string(pair.Value) != "foo" {
+		t.Errorf("value overwritten despite cas: %s", pair.Value)
+	}
+
+	keys, _, err := client.KV().Keys("app/config/", "", nil)
+	if err != nil {
+		t.Fatalf("keys err: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("keys not deleted: %v", keys)
+	}
+
+	// watch the prefix while a key changes
+	go func() {
+		time.Sleep(time.Second)
+		client.KV().Put(&consul.KVPair{Key: "app/name", Value: []byte("baz")}, nil)
+	}()
+
+	jsonBody, _ := json.Marshal(map[string]interface{}{
+		"endpoint":     conf.Address,
+		"action":       "list",
+		"key":          "app/",
+		"watch":        true,
+		"watchTimeout": "3s",
+	})
+	req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(consulkv.Serve).ServeHTTP(rr, req)
+
+	events := []consulwatch.Event{}
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		e := consulwatch.Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("can't parse event: %s", err)
+		}
+		events = append(events, e)
+	}
+	fmt.Printf("events: \n%+v\n", events)
+	if len(events) != 3 || events[0].Type != "snapshot" || events[1].Type != "change" || events[2].Type != "end" {
+		t.Fatalf("wrong events: %+v", events)
+	}
+	if c := events[1].Changed["app/name"]; c.From != "foo" || c.To != "baz" {
+		t.Errorf("wrong change: %+v", events[1])
+	}
+
+	// an edit past the part of the value shown is a change all the same
+	long := strings.Repeat("a", 200)
+	if _, err := client.KV().Put(&consul.KVPair{Key: "app/long", Value: []byte(long)}, nil); err != nil {
+		t.Fatalf("put err: %v", err)
+	}
+	go func() {
+		time.Sleep(time.Second)
+		client.KV().Put(&consul.KVPair{Key: "app/long", Value: []byte(long[:199] + "b")}, nil)
+	}()
+
+	jsonBody, _ = json.Marshal(map[string]interface{}{
+		"endpoint":     conf.Address,
+		"action":       "get",
+		"key":          "app/long",
+		"watch":        true,
+		"watchTimeout": "3s",
+	})
+	req = httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(consulkv.Serve).ServeHTTP(rr, req)
+
+	events = []consulwatch.Event{}
+	scanner = bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		e := consulwatch.Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("can't parse event: %s", err)
+		}
+		events = append(events, e)
+	}
+	fmt.Printf("events: \n%+v\n", events)
+	if len(events) != 3 || events[1].Type != "change" {
+		t.Fatalf("edit past the cut missed: %+v", events)
+	}
+	if c := events[1].Changed["app/long"]; len(c.From) >= len(long) || c.From != c.To {
+		t.Errorf("values not cut in the event: %+v", c)
+	}
+}
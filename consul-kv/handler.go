@@ -0,0 +1,12 @@
+package function
+
+import (
+	"net/http"
+
+	consulkv "github.com/efbar/more-serverless/consul-kv/consulkv"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+
+	consulkv.Serve(w, r)
+}
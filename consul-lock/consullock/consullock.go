@@ -0,0 +1,149 @@
+// Package consullock lets only one invocation at a time work on the same
+// target, with a Consul lock for every target.
+package consullock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// Prefix is the Consul KV prefix of the locks, there is a key for every
+// target.
+const Prefix = "more-serverless/locks/"
+
+// failFastWait is how long a lock held by someone else is waited for when no
+// wait is requested, the shortest blocking query worth doing.
+const failFastWait = time.Second
+
+// ErrLocked is wrapped by the error of Acquire when a target is still locked
+// by someone else after the wait.
+var ErrLocked = errors.New("locked")
+
+// Options enables the Consul lock, for the functions taking it in the
+// request.
+type Options struct {
+	Endpoint string `json:"endpoint"`
+	Token    string `json:"token,omitempty"`
+	Wait     string `json:"wait,omitempty"`
+}
+
+// ParseWait parses how long to wait for a lock held by someone else,
+// failing fast if empty.
+func ParseWait(wait string) (time.Duration, error) {
+	if len(wait) == 0 {
+		return failFastWait, nil
+	}
+	d, err := time.ParseDuration(wait)
+	if err != nil {
+		return 0, err
+	}
+	if d < failFastWait {
+		d = failFastWait
+	}
+	return d, nil
+}
+
+// Acquire takes the locks of targets for owner, in a fixed order so that two
+// invocations on the same targets can't deadlock, each with a new session
+// renewed until the returned unlock is called. The returned context is
+// cancelled if a lock is lost before that, so that the work done under it
+// stops.
+func Acquire(ctx context.Context, endpoint, token string, wait time.Duration, owner string, targets ...string) (context.Context, func(), error) {
+	conf := consul.DefaultConfig()
+
+	conf.Address = endpoint
+
+	if token != "" {
+		conf.Token = token
+	}
+
+	client, err := consul.NewClient(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sorted := append([]string{}, targets...)
+	sort.Strings(sorted)
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	locks := []*consul.Lock{}
+	keys := []string{}
+	unlock := func() {
+		close(done)
+		for i := len(locks) - 1; i >= 0; i-- {
+			if err := locks[i].Unlock(); err != nil {
+				fmt.Printf("unlock %s error: %s\n", keys[i], err)
+			}
+		}
+		cancel()
+	}
+
+	for i, target := range sorted {
+		if i > 0 && target == sorted[i-1] {
+			continue
+		}
+		key := Prefix + target
+		lock, lost, err := lockKey(client, key, wait, owner, target)
+		if err != nil {
+			unlock()
+			return nil, nil, err
+		}
+		locks = append(locks, lock)
+		keys = append(keys, key)
+		go watchLost(key, lost, done, cancel)
+		fmt.Printf("lock %s acquired\n", key)
+	}
+
+	return ctx, unlock, nil
+}
+
+// lockKey takes the lock on key, the error wraps ErrLocked if it is still
+// held by someone else after wait.
+func lockKey(client *consul.Client, key string, wait time.Duration, owner, target string) (*consul.Lock, <-chan struct{}, error) {
+	lock, err := client.LockOpts(&consul.LockOptions{
+		Key:          key,
+		Value:        []byte(owner + " since " + time.Now().UTC().Format(time.RFC3339)),
+		SessionName:  owner + " " + target,
+		LockWaitTime: wait,
+		LockTryOnce:  true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lost, err := lock.Lock(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lost == nil {
+		// the value says who holds the lock and since when
+		holder := ""
+		if pair, _, err := client.KV().Get(key, nil); err == nil && pair != nil {
+			holder = " by " + string(pair.Value)
+		}
+		return nil, nil, fmt.Errorf("%s %w%s", target, ErrLocked, holder)
+	}
+	return lock, lost, nil
+}
+
+// watchLost cancels the work when the lock of key is lost, its session
+// expired or the key deleted, until done is closed.
+func watchLost(key string, lost <-chan struct{}, done <-chan struct{}, cancel func()) {
+	select {
+	case <-lost:
+		select {
+		case <-done:
+			return
+		default:
+		}
+		fmt.Printf("lock %s lost, cancelling\n", key)
+		cancel()
+	case <-done:
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -13,25 +14,33 @@ import (
 )
 
 type RequestBody struct {
-	Token    string `json:"token"`
-	Endpoint string `json:"endpoint"`
+	Token     string `json:"token"`
+	Endpoint  string `json:"endpoint"`
+	WAN       bool   `json:"wan,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Segment   string `json:"segment,omitempty"`
+	Partition string `json:"partition,omitempty"`
+	Detailed  bool   `json:"detailed,omitempty"`
 }
 
 type Response struct {
 	Payload []AgentMember       `json:"payload"`
+	Summary map[string]int      `json:"summary"`
 	Headers map[string][]string `json:"headers"`
 }
 
 type AgentMember struct {
-	Name        string `json:"name"`
-	Addr        string `json:"address"`
-	Port        uint16 `json:"port"`
-	Status      string `json:"status"`
-	Type        string `json:"type"`
-	ProtocolCur string `json:"protocol"`
-	Build       string `json:"build"`
-	Datacenter  string `json:"dc"`
-	Segment     string `json:"segment"`
+	Name        string            `json:"name"`
+	Addr        string            `json:"address"`
+	Port        uint16            `json:"port"`
+	Status      string            `json:"status"`
+	Type        string            `json:"type"`
+	ProtocolCur string            `json:"protocol"`
+	Build       string            `json:"build"`
+	Datacenter  string            `json:"dc"`
+	Segment     string            `json:"segment"`
+	Partition   string            `json:"partition,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
 }
 
 type ByMemberNameAndSegment []*consul.AgentMember
@@ -89,24 +98,58 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// same as the -status flag of consul members, an anchored regexp
+	statusRe, err := regexp.Compile("^(?:" + rb.Status + ")$")
+	if err != nil {
+		fmt.Println("invalid status:", err.Error())
+		http.Error(w, fmt.Sprintf("invalid status: %s", err), http.StatusBadRequest)
+		return
+	}
+
 	agent := client.Agent()
 	// Make the request.
-	members, err := agent.Members(false)
+	all, err := agent.MembersOpts(consul.MembersOpts{
+		WAN:     rb.WAN,
+		Segment: rb.Segment,
+	})
 	if err != nil {
 		fmt.Println("error getting members:", err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	members := []*consul.AgentMember{}
+	summary := map[string]int{}
+	for _, v := range all {
+		_, agentStatus, _, _ := getMemberInfo(v)
+		if len(rb.Status) != 0 && !statusRe.MatchString(agentStatus) {
+			continue
+		}
+		if len(rb.Partition) != 0 && partition(v) != rb.Partition {
+			continue
+		}
+		members = append(members, v)
+		summary[agentStatus]++
+	}
+
 	sort.Sort(ByMemberNameAndSegment(members))
 
 	resBody := ""
 	if r.Header.Get("Content-Type") == "text/plain" {
 		out := []string{"Node\tAddress\tStatus\tType\tBuild\tProtocol\tDC\tSegment"}
+		if rb.Detailed {
+			out = []string{"Node\tAddress\tStatus\tTags"}
+		}
 		for _, v := range members {
 			agentType, agentStatus, build, segments := getMemberInfo(v)
+			if rb.Detailed {
+				out = append(out, v.Name+"\t"+fmt.Sprintf("%s:%d", v.Addr, v.Port)+"\t"+agentStatus+"\t"+formatTags(v.Tags))
+				continue
+			}
 			out = append(out, v.Name+"\t"+v.Addr+"\t"+agentStatus+"\t"+agentType+"\t"+build+"\t"+v.Tags["vsn"]+"\t"+v.Tags["dc"]+"\t"+segments)
 		}
+		out = append(out, "")
+		out = append(out, "Summary\t"+formatSummary(summary))
 		columnConf := columnize.DefaultConfig()
 		columnConf.Delim = "\t"
 		columnConf.Glue = "  "
@@ -128,11 +171,16 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 				Build:       build,
 				Datacenter:  v.Tags["dc"],
 				Segment:     segments,
+				Partition:   v.Tags["ap"],
+			}
+			if rb.Detailed {
+				member.Tags = v.Tags
 			}
 			memberList = append(memberList, member)
 		}
 		jsonResponse := Response{
 			Payload: memberList,
+			Summary: summary,
 			Headers: r.Header,
 		}
 		resBody, err := json.Marshal(jsonResponse)
@@ -176,11 +224,13 @@ func getMemberInfo(v *consul.AgentMember) (string, string, string, string) {
 		agentStatus = "unknown"
 	}
 
-	var segment string
-	if v.Tags["segment"] == "" && v.Tags["role"] == "consul" {
-		segment = "<all>"
-	} else {
+	// servers are in every segment
+	segment := v.Tags["segment"]
+	if segment == "" {
 		segment = "<default>"
+		if v.Tags["role"] == "consul" {
+			segment = "<all>"
+		}
 	}
 
 	build := v.Tags["build"]
@@ -192,3 +242,38 @@ func getMemberInfo(v *consul.AgentMember) (string, string, string, string) {
 
 	return agentType, agentStatus, build, segment
 }
+
+// partition returns the admin partition of a member, members of agents
+// without partitions being in the default one.
+func partition(v *consul.AgentMember) string {
+	if ap := v.Tags["ap"]; ap != "" {
+		return ap
+	}
+	return "default"
+}
+
+func formatTags(tags map[string]string) string {
+	pairs := []string{}
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func formatSummary(summary map[string]int) string {
+	statuses := []string{}
+	for s := range summary {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+
+	counts := []string{}
+	for _, s := range statuses {
+		counts = append(counts, fmt.Sprintf("%s: %d", s, summary[s]))
+	}
+	if len(counts) == 0 {
+		return "no members"
+	}
+	return strings.Join(counts, ", ")
+}
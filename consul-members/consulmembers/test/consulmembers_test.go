@@ -20,6 +20,10 @@ func TestFunc(t *testing.T) {
 		aclenabled  bool
 		loglevel    string
 		contentType string
+		wan         bool
+		status      string
+		detailed    bool
+		members     int
 	}{
 		{
 			aclenabled:  true,
@@ -30,6 +34,20 @@ func TestFunc(t *testing.T) {
 			aclenabled:  false,
 			loglevel:    "INFO",
 			contentType: "application/json",
+			members:     1,
+		},
+		{
+			aclenabled:  false,
+			loglevel:    "INFO",
+			contentType: "text/plain",
+			wan:         true,
+			detailed:    true,
+		},
+		{
+			aclenabled:  false,
+			loglevel:    "INFO",
+			contentType: "application/json",
+			status:      "failed|left",
 		},
 	}
 
@@ -65,6 +83,9 @@ func TestFunc(t *testing.T) {
 
 		jsonStruct := map[string]interface{}{
 			"endpoint": conf.Address,
+			"wan":      tr.wan,
+			"status":   tr.status,
+			"detailed": tr.detailed,
 		}
 
 		// here acl token part
@@ -127,6 +148,24 @@ func TestFunc(t *testing.T) {
 				status, http.StatusOK)
 		}
 
+		if tr.contentType == "application/json" {
+			res := consulmembers.Response{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("can't parse response: %s", err)
+			}
+			if len(res.Payload) != tr.members {
+				t.Errorf("wrong number of members: got %d want %d", len(res.Payload), tr.members)
+			}
+			if res.Summary["alive"] != tr.members {
+				t.Errorf("wrong summary: %v", res.Summary)
+			}
+			for _, m := range res.Payload {
+				if m.Segment != "<all>" {
+					t.Errorf("wrong segment for server %s: %s", m.Name, m.Segment)
+				}
+			}
+		}
+
 		fmt.Printf("response body: \n%s\n", rr.Body)
 	}
 
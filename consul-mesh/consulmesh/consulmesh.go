@@ -0,0 +1,277 @@
+package consulmesh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/ryanuber/columnize"
+)
+
+type RequestBody struct {
+	Token       string            `json:"token"`
+	Endpoint    string            `json:"endpoint"`
+	Action      string            `json:"action"`
+	ID          string            `json:"id,omitempty"`
+	Source      string            `json:"source,omitempty"`
+	Destination string            `json:"destination,omitempty"`
+	Intention   string            `json:"intention,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Meta        map[string]string `json:"meta,omitempty"`
+	Replace     bool              `json:"replace,omitempty"`
+	Kind        string            `json:"kind,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Entry       json.RawMessage   `json:"entry,omitempty"`
+}
+
+type Payload struct {
+	Intentions []*consul.Intention  `json:"intentions,omitempty"`
+	Intention  *consul.Intention    `json:"intention,omitempty"`
+	Allowed    *bool                `json:"allowed,omitempty"`
+	Entry      consul.ConfigEntry   `json:"entry,omitempty"`
+	Entries    []consul.ConfigEntry `json:"entries,omitempty"`
+	Message    string               `json:"message,omitempty"`
+}
+
+type Response struct {
+	Payload Payload             `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	switch rb.Action {
+	case "list", "":
+	case "create", "check":
+		if len(rb.Source) == 0 || len(rb.Destination) == 0 {
+			fmt.Println("empty source or destination")
+			http.Error(w, "empty source or destination", http.StatusBadRequest)
+			return
+		}
+	case "delete":
+		if len(rb.ID) == 0 && (len(rb.Source) == 0 || len(rb.Destination) == 0) {
+			fmt.Println("empty id, source or destination")
+			http.Error(w, "delete needs either id or source and destination", http.StatusBadRequest)
+			return
+		}
+	case "config-read":
+		if len(rb.Kind) == 0 {
+			fmt.Println("empty kind")
+			http.Error(w, "empty kind", http.StatusBadRequest)
+			return
+		}
+	case "config-write":
+		if len(rb.Entry) == 0 {
+			fmt.Println("empty entry")
+			http.Error(w, "empty entry", http.StatusBadRequest)
+			return
+		}
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	conf := consul.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	if rb.Token != "" {
+		conf.Token = rb.Token
+	}
+
+	client, err := consul.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	connect := client.Connect()
+	configEntries := client.ConfigEntries()
+
+	payload := Payload{}
+	switch rb.Action {
+	case "list", "":
+		payload.Intentions, _, err = connect.Intentions(nil)
+		if err == nil && payload.Intentions == nil {
+			payload.Intentions = []*consul.Intention{}
+		}
+		sort.Slice(payload.Intentions, func(i, j int) bool {
+			return payload.Intentions[i].Precedence > payload.Intentions[j].Precedence
+		})
+
+	case "create":
+		intention, decisionErr := newIntention(&rb)
+		if decisionErr != nil {
+			fmt.Println(decisionErr.Error())
+			http.Error(w, decisionErr.Error(), http.StatusBadRequest)
+			return
+		}
+		// upsert needs Consul 1.9, create fails if the intention exists
+		if rb.Replace {
+			_, err = connect.IntentionUpsert(intention, nil)
+		} else {
+			intention.ID, _, err = connect.IntentionCreate(intention, nil)
+		}
+		if err == nil {
+			payload.Intention = intention
+			payload.Message = fmt.Sprintf("Created: %s", intention)
+		}
+
+	case "delete":
+		if len(rb.ID) != 0 {
+			_, err = connect.IntentionDelete(rb.ID, nil)
+			payload.Message = fmt.Sprintf("Intention %s deleted.", rb.ID)
+		} else {
+			_, err = connect.IntentionDeleteExact(rb.Source, rb.Destination, nil)
+			payload.Message = fmt.Sprintf("Intention %s => %s deleted.", rb.Source, rb.Destination)
+		}
+
+	case "check":
+		var allowed bool
+		allowed, _, err = connect.IntentionCheck(&consul.IntentionCheck{
+			Source:      rb.Source,
+			Destination: rb.Destination,
+			SourceType:  consul.IntentionSourceConsul,
+		}, nil)
+		if err == nil {
+			payload.Allowed = &allowed
+			payload.Message = "Denied"
+			if allowed {
+				payload.Message = "Allowed"
+			}
+		}
+
+	case "config-read":
+		if len(rb.Name) == 0 {
+			payload.Entries, _, err = configEntries.List(rb.Kind, nil)
+			if err == nil && payload.Entries == nil {
+				payload.Entries = []consul.ConfigEntry{}
+			}
+			break
+		}
+		payload.Entry, _, err = configEntries.Get(rb.Kind, rb.Name, nil)
+
+	case "config-write":
+		entry, decodeErr := consul.DecodeConfigEntryFromJSON(rb.Entry)
+		if decodeErr != nil {
+			fmt.Println("Error decoding config entry:", decodeErr.Error())
+			http.Error(w, fmt.Sprintf("invalid entry: %s", decodeErr), http.StatusBadRequest)
+			return
+		}
+		var ok bool
+		ok, _, err = configEntries.Set(entry, nil)
+		if err == nil && !ok {
+			err = fmt.Errorf("config entry %s/%s not written", entry.GetKind(), entry.GetName())
+		}
+		if err == nil {
+			payload.Entry = entry
+			payload.Message = fmt.Sprintf("Config entry written: %s/%s", entry.GetKind(), entry.GetName())
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error on %s: %s\n", orDefault(rb.Action, "list"), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Header.Get("Content-Type") == "text/plain" {
+		resBody, err := formatPayload(&payload)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+func newIntention(rb *RequestBody) (*consul.Intention, error) {
+	decision := consul.IntentionAction(orDefault(rb.Intention, string(consul.IntentionActionAllow)))
+	if decision != consul.IntentionActionAllow && decision != consul.IntentionActionDeny {
+		return nil, fmt.Errorf("intention must be allow or deny, not %q", rb.Intention)
+	}
+	return &consul.Intention{
+		SourceName:      rb.Source,
+		DestinationName: rb.Destination,
+		SourceType:      consul.IntentionSourceConsul,
+		Action:          decision,
+		Description:     rb.Description,
+		Meta:            rb.Meta,
+	}, nil
+}
+
+// formatPayload prints intentions as a matrix and config entries as json,
+// the same as `consul config read`.
+func formatPayload(payload *Payload) (string, error) {
+	switch {
+	case payload.Intentions != nil:
+		return formatMatrix(payload.Intentions), nil
+
+	case payload.Entry != nil && len(payload.Message) == 0:
+		entry, err := json.MarshalIndent(payload.Entry, "", "    ")
+		if err != nil {
+			return "", err
+		}
+		return string(entry) + "\n", nil
+
+	case payload.Entries != nil:
+		out := []string{"Kind\tName"}
+		for _, e := range payload.Entries {
+			out = append(out, fmt.Sprintf("%s\t%s", e.GetKind(), e.GetName()))
+		}
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "  "
+		columnConf.NoTrim = false
+		return columnize.Format(out, columnConf), nil
+	}
+	return payload.Message + "\n", nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package consulmesh
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/ryanuber/columnize"
+)
+
+// formatMatrix prints intentions with a row for every source and a column
+// for every destination. Cells hold allow or deny, L7 for intentions with
+// permissions, and are empty when no intention matches exactly, the
+// wildcards having their own row and column.
+func formatMatrix(intentions []*consul.Intention) string {
+	if len(intentions) == 0 {
+		return "No intentions found\n"
+	}
+
+	cells := map[string]string{}
+	sourceSet := map[string]bool{}
+	destinationSet := map[string]bool{}
+	for _, i := range intentions {
+		source, destination := i.SourceString(), i.DestinationString()
+		sourceSet[source] = true
+		destinationSet[destination] = true
+
+		decision := string(i.Action)
+		if len(i.Permissions) != 0 {
+			decision = "L7"
+		}
+		cells[source+"\x00"+destination] = decision
+	}
+	sources := sortedNames(sourceSet)
+	destinations := sortedNames(destinationSet)
+
+	out := []string{"Source \\ Destination\t" + strings.Join(destinations, "\t")}
+	for _, s := range sources {
+		row := []string{s}
+		for _, d := range destinations {
+			row = append(row, orDefault(cells[s+"\x00"+d], "-"))
+		}
+		out = append(out, strings.Join(row, "\t"))
+	}
+	out = append(out, "")
+	out = append(out, fmt.Sprintf("%d intentions", len(intentions)))
+
+	columnConf := columnize.DefaultConfig()
+	columnConf.Delim = "\t"
+	columnConf.Glue = "  "
+	columnConf.NoTrim = false
+	return columnize.Format(out, columnConf)
+}
+
+// sortedNames sorts names with the wildcard last, like it is last in
+// precedence.
+func sortedNames(set map[string]bool) []string {
+	names := []string{}
+	for n := range set {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		iWild, jWild := strings.HasSuffix(names[i], "*"), strings.HasSuffix(names[j], "*")
+		if iWild != jWild {
+			return jWild
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
@@ -0,0 +1,151 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	consulmesh "github.com/efbar/more-serverless/consul-mesh/consulmesh"
+	consul "github.com/hashicorp/consul/api"
+	testutil "github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+)
+
+func TestFunc(t *testing.T) {
+
+	var server *testutil.TestServer
+	var err error
+	retry.RunWith(retry.ThreeTimes(), t, func(r *retry.R) {
+		server, err = testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+			c.LogLevel = "INFO"
+			c.NodeName = "testnode"
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err.Error())
+	}
+	defer server.Stop()
+	server.WaitForSerfCheck(t)
+
+	if server.Config.Bootstrap {
+		server.WaitForLeader(t)
+	}
+
+	conf := consul.DefaultConfig()
+	conf.Address = "http://" + server.HTTPAddr
+
+	tt := []struct {
+		contentType string
+		request     map[string]interface{}
+		status      int
+		allowed     interface{}
+	}{
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "create", "source": "web", "destination": "db", "intention": "deny"},
+			status:      http.StatusOK,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "create", "source": "api", "destination": "db"},
+			status:      http.StatusOK,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "create", "source": "api", "destination": "db", "intention": "maybe"},
+			status:      http.StatusBadRequest,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "check", "source": "web", "destination": "db"},
+			status:      http.StatusOK,
+			allowed:     false,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "check", "source": "api", "destination": "db"},
+			status:      http.StatusOK,
+			allowed:     true,
+		},
+		{
+			contentType: "text/plain",
+			request:     map[string]interface{}{"action": "list"},
+			status:      http.StatusOK,
+		},
+		{
+			contentType: "application/json",
+			request: map[string]interface{}{"action": "config-write", "entry": map[string]interface{}{
+				"Kind":     "service-defaults",
+				"Name":     "db",
+				"Protocol": "http",
+			}},
+			status: http.StatusOK,
+		},
+		{
+			contentType: "text/plain",
+			request:     map[string]interface{}{"action": "config-read", "kind": "service-defaults", "name": "db"},
+			status:      http.StatusOK,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "delete", "source": "web", "destination": "db"},
+			status:      http.StatusOK,
+		},
+	}
+
+	for _, tr := range tt {
+		t.Log(tr.request)
+
+		tr.request["endpoint"] = conf.Address
+
+		jsonBody, _ := json.Marshal(tr.request)
+		req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+		req.Header.Set("Content-Type", tr.contentType)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(consulmesh.Serve)
+
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tr.status {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, tr.status)
+		}
+
+		if tr.allowed != nil {
+			res := map[string]map[string]interface{}{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("can't parse response: %s", err)
+			}
+			if res["payload"]["allowed"] != tr.allowed {
+				t.Errorf("wrong check: got %v want %v", res["payload"]["allowed"], tr.allowed)
+			}
+		}
+
+		fmt.Printf("response body: \n%s\n", rr.Body)
+	}
+
+	client, err := consul.NewClient(conf)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+	intentions, _, err := client.Connect().Intentions(nil)
+	if err != nil {
+		t.Fatalf("intentions err: %v", err)
+	}
+	if len(intentions) != 1 || intentions[0].SourceName != "api" {
+		t.Errorf("wrong intentions left: %v", intentions)
+	}
+
+	entry, _, err := client.ConfigEntries().Get(consul.ServiceDefaults, "db", nil)
+	if err != nil {
+		t.Fatalf("config entry err: %v", err)
+	}
+	if entry.(*consul.ServiceConfigEntry).Protocol != "http" {
+		t.Errorf("wrong config entry: %+v", entry)
+	}
+}
@@ -0,0 +1,12 @@
+package function
+
+import (
+	"net/http"
+
+	consulmesh "github.com/efbar/more-serverless/consul-mesh/consulmesh"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+
+	consulmesh.Serve(w, r)
+}
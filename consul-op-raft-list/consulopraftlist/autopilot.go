@@ -0,0 +1,200 @@
+package consulopraftlist
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/ryanuber/columnize"
+)
+
+// AutopilotConfig holds the settings to change with autopilot-set-config,
+// like the flags of `consul operator autopilot set-config`: whatever is not
+// set is left as it is.
+type AutopilotConfig struct {
+	CleanupDeadServers      *bool   `json:"cleanupDeadServers,omitempty"`
+	LastContactThreshold    string  `json:"lastContactThreshold,omitempty"`
+	MaxTrailingLogs         *uint64 `json:"maxTrailingLogs,omitempty"`
+	MinQuorum               *uint   `json:"minQuorum,omitempty"`
+	ServerStabilizationTime string  `json:"serverStabilizationTime,omitempty"`
+	RedundancyZoneTag       *string `json:"redundancyZoneTag,omitempty"`
+	DisableUpgradeMigration *bool   `json:"disableUpgradeMigration,omitempty"`
+	UpgradeVersionTag       *string `json:"upgradeVersionTag,omitempty"`
+}
+
+type ServerState struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Address     string    `json:"address"`
+	Status      string    `json:"status"`
+	Version     string    `json:"version"`
+	Healthy     bool      `json:"healthy"`
+	LastContact string    `json:"lastContact"`
+	LastTerm    uint64    `json:"lastTerm"`
+	LastIndex   uint64    `json:"lastIndex"`
+	StableSince time.Time `json:"stableSince"`
+}
+
+type Autopilot struct {
+	Config           *consul.AutopilotConfiguration `json:"config,omitempty"`
+	Healthy          bool                           `json:"healthy"`
+	FailureTolerance int                            `json:"failureTolerance"`
+	Leader           string                         `json:"leader,omitempty"`
+	Servers          []ServerState                  `json:"servers,omitempty"`
+}
+
+// apply changes the settings of ac set in current.
+func (ac *AutopilotConfig) apply(current *consul.AutopilotConfiguration) error {
+	if ac.CleanupDeadServers != nil {
+		current.CleanupDeadServers = *ac.CleanupDeadServers
+	}
+	if len(ac.LastContactThreshold) != 0 {
+		d, err := time.ParseDuration(ac.LastContactThreshold)
+		if err != nil {
+			return fmt.Errorf("invalid lastContactThreshold: %s", err)
+		}
+		current.LastContactThreshold = consul.NewReadableDuration(d)
+	}
+	if ac.MaxTrailingLogs != nil {
+		current.MaxTrailingLogs = *ac.MaxTrailingLogs
+	}
+	if ac.MinQuorum != nil {
+		current.MinQuorum = *ac.MinQuorum
+	}
+	if len(ac.ServerStabilizationTime) != 0 {
+		d, err := time.ParseDuration(ac.ServerStabilizationTime)
+		if err != nil {
+			return fmt.Errorf("invalid serverStabilizationTime: %s", err)
+		}
+		current.ServerStabilizationTime = consul.NewReadableDuration(d)
+	}
+	if ac.RedundancyZoneTag != nil {
+		current.RedundancyZoneTag = *ac.RedundancyZoneTag
+	}
+	if ac.DisableUpgradeMigration != nil {
+		current.DisableUpgradeMigration = *ac.DisableUpgradeMigration
+	}
+	if ac.UpgradeVersionTag != nil {
+		current.UpgradeVersionTag = *ac.UpgradeVersionTag
+	}
+	return nil
+}
+
+// autopilotState is `consul operator autopilot state`, available since
+// Consul 1.10.
+func autopilotState(client *consul.Client) (*Autopilot, error) {
+	state, err := client.Operator().AutopilotState(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	autopilot := &Autopilot{
+		Healthy:          state.Healthy,
+		FailureTolerance: state.FailureTolerance,
+		Leader:           state.Leader,
+		Servers:          []ServerState{},
+	}
+	for _, s := range state.Servers {
+		autopilot.Servers = append(autopilot.Servers, ServerState{
+			ID:          s.ID,
+			Name:        s.Name,
+			Address:     s.Address,
+			Status:      string(s.Status),
+			Version:     s.Version,
+			Healthy:     s.Healthy,
+			LastContact: lastContact(s.LastContact),
+			LastTerm:    s.LastTerm,
+			LastIndex:   s.LastIndex,
+			StableSince: s.StableSince,
+		})
+	}
+	sortServers(autopilot.Servers)
+	return autopilot, nil
+}
+
+// autopilotHealth is the server health known to older servers too.
+func autopilotHealth(client *consul.Client) (*Autopilot, error) {
+	health, err := client.Operator().AutopilotServerHealth(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	autopilot := &Autopilot{
+		Healthy:          health.Healthy,
+		FailureTolerance: health.FailureTolerance,
+		Servers:          []ServerState{},
+	}
+	for _, s := range health.Servers {
+		status := "non-voter"
+		switch {
+		case s.Leader:
+			status = "leader"
+			autopilot.Leader = s.ID
+		case s.Voter:
+			status = "voter"
+		}
+		autopilot.Servers = append(autopilot.Servers, ServerState{
+			ID:          s.ID,
+			Name:        s.Name,
+			Address:     s.Address,
+			Status:      status,
+			Version:     s.Version,
+			Healthy:     s.Healthy,
+			LastContact: lastContact(s.LastContact),
+			LastTerm:    s.LastTerm,
+			LastIndex:   s.LastIndex,
+			StableSince: s.StableSince,
+		})
+	}
+	sortServers(autopilot.Servers)
+	return autopilot, nil
+}
+
+func sortServers(servers []ServerState) {
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Name < servers[j].Name
+	})
+}
+
+func lastContact(d *consul.ReadableDuration) string {
+	if d == nil {
+		return "-"
+	}
+	return d.String()
+}
+
+func formatAutopilot(autopilot *Autopilot) string {
+	columnConf := columnize.DefaultConfig()
+	columnConf.Delim = "\t"
+	columnConf.Glue = "  "
+	columnConf.NoTrim = false
+
+	if c := autopilot.Config; c != nil {
+		out := []string{
+			fmt.Sprintf("CleanupDeadServers\t= %v", c.CleanupDeadServers),
+			fmt.Sprintf("LastContactThreshold\t= %s", c.LastContactThreshold.String()),
+			fmt.Sprintf("MaxTrailingLogs\t= %d", c.MaxTrailingLogs),
+			fmt.Sprintf("MinQuorum\t= %d", c.MinQuorum),
+			fmt.Sprintf("ServerStabilizationTime\t= %s", c.ServerStabilizationTime.String()),
+			fmt.Sprintf("RedundancyZoneTag\t= %q", c.RedundancyZoneTag),
+			fmt.Sprintf("DisableUpgradeMigration\t= %v", c.DisableUpgradeMigration),
+			fmt.Sprintf("UpgradeVersionTag\t= %q", c.UpgradeVersionTag),
+		}
+		return columnize.Format(out, columnConf)
+	}
+
+	out := []string{
+		fmt.Sprintf("Healthy:\t%v", autopilot.Healthy),
+		fmt.Sprintf("Failure Tolerance:\t%d", autopilot.FailureTolerance),
+		fmt.Sprintf("Leader:\t%s", autopilot.Leader),
+	}
+	resBody := columnize.Format(out, columnConf) + "\n\n"
+
+	out = []string{"Node\tID\tAddress\tStatus\tHealthy\tLast Contact\tLast Term\tLast Index\tStable Since\tVersion"}
+	for _, s := range autopilot.Servers {
+		out = append(out, fmt.Sprintf("%s\t%s\t%s\t%s\t%v\t%s\t%d\t%d\t%s\t%s",
+			s.Name, s.ID, s.Address, s.Status, s.Healthy, s.LastContact, s.LastTerm, s.LastIndex, s.StableSince.Format(time.RFC3339), s.Version))
+	}
+	return resBody + columnize.Format(out, columnConf)
+}
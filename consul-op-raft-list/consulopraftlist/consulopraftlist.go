@@ -12,13 +12,20 @@ import (
 )
 
 type RequestBody struct {
-	Token    string `json:"token"`
-	Endpoint string `json:"endpoint"`
+	Token     string           `json:"token"`
+	Endpoint  string           `json:"endpoint"`
+	Action    string           `json:"action"`
+	ID        string           `json:"id,omitempty"`
+	Address   string           `json:"address,omitempty"`
+	Confirm   string           `json:"confirm,omitempty"`
+	Autopilot *AutopilotConfig `json:"autopilot,omitempty"`
 }
 
 type Response struct {
-	Payload []Peer              `json:"payload"`
-	Headers map[string][]string `json:"headers"`
+	Payload   []Peer              `json:"payload"`
+	Autopilot *Autopilot          `json:"autopilot,omitempty"`
+	Message   string              `json:"message,omitempty"`
+	Headers   map[string][]string `json:"headers"`
 }
 
 type Peer struct {
@@ -30,6 +37,13 @@ type Peer struct {
 	RaftProtocol string  `json:"raft-protocol"`
 }
 
+// guarded actions change the raft configuration and must be confirmed
+// repeating the action name.
+var guarded = map[string]bool{
+	"remove-peer":     true,
+	"transfer-leader": true,
+}
+
 func Serve(w http.ResponseWriter, r *http.Request) {
 
 	var input []byte
@@ -56,6 +70,32 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	switch rb.Action {
+	case "list-peers", "", "transfer-leader", "autopilot-get-config", "autopilot-state", "autopilot-health":
+	case "remove-peer":
+		if (len(rb.ID) == 0) == (len(rb.Address) == 0) {
+			fmt.Println("remove-peer needs either id or address")
+			http.Error(w, "remove-peer needs either id or address", http.StatusBadRequest)
+			return
+		}
+	case "autopilot-set-config":
+		if rb.Autopilot == nil {
+			fmt.Println("empty autopilot configuration")
+			http.Error(w, "empty autopilot configuration", http.StatusBadRequest)
+			return
+		}
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	if guarded[rb.Action] && rb.Confirm != rb.Action {
+		fmt.Printf("%s not confirmed\n", rb.Action)
+		http.Error(w, fmt.Sprintf("%s must be confirmed with \"confirm\": %q", rb.Action, rb.Action), http.StatusBadRequest)
+		return
+	}
+
 	conf := consul.DefaultConfig()
 
 	conf.Address = rb.Endpoint
@@ -71,51 +111,109 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	q := &consul.QueryOptions{
-		AllowStale: true,
+	operator := client.Operator()
+
+	var autopilot *Autopilot
+	message := ""
+	switch rb.Action {
+	case "remove-peer":
+		if len(rb.ID) != 0 {
+			err = operator.RaftRemovePeerByID(rb.ID, nil)
+			message = fmt.Sprintf("Removed peer with id %q", rb.ID)
+		} else {
+			err = operator.RaftRemovePeerByAddress(rb.Address, nil)
+			message = fmt.Sprintf("Removed peer with address %q", rb.Address)
+		}
+
+	case "transfer-leader":
+		err = transferLeader(conf, rb.ID)
+		message = "Success"
+
+	case "autopilot-get-config":
+		var config *consul.AutopilotConfiguration
+		config, err = operator.AutopilotGetConfiguration(nil)
+		autopilot = &Autopilot{Config: config}
+
+	case "autopilot-set-config":
+		var config *consul.AutopilotConfiguration
+		config, err = operator.AutopilotGetConfiguration(nil)
+		if err != nil {
+			break
+		}
+		if err := rb.Autopilot.apply(config); err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// only if nobody else changed it in the meantime
+		var ok bool
+		ok, err = operator.AutopilotCASConfiguration(config, nil)
+		if err == nil && !ok {
+			fmt.Println("autopilot configuration changed concurrently")
+			http.Error(w, "Configuration could not be atomically updated, please try again", http.StatusConflict)
+			return
+		}
+		autopilot = &Autopilot{Config: config}
+		message = "Configuration updated!"
+
+	case "autopilot-state":
+		autopilot, err = autopilotState(client)
+
+	case "autopilot-health":
+		autopilot, err = autopilotHealth(client)
 	}
-	peers, err := client.Operator().RaftGetConfiguration(q)
 	if err != nil {
-		fmt.Println(err.Error())
+		fmt.Printf("Error on %s: %s\n", rb.Action, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if r.Header.Get("Content-Type") == "text/plain" {
-		out := []string{"Node\tID\tAddress\tState\tVoter\tRaftProtocol"}
-		for _, v := range peers.Servers {
-			raftProtocol, state := getInfo(v)
-			out = append(
-				out,
-				fmt.Sprintf("%s\t%s\t%s\t%s\t%v\t%s",
-					v.Node, v.ID, v.Address, state, v.Voter, raftProtocol))
+	var peers *consul.RaftConfiguration
+	if autopilot == nil {
+		q := &consul.QueryOptions{
+			AllowStale: true,
+		}
+		peers, err = operator.RaftGetConfiguration(q)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+	}
+
+	if r.Header.Get("Content-Type") == "text/plain" {
 		resBody := ""
-		sort.Strings(out)
-		columnConf := columnize.DefaultConfig()
-		columnConf.Delim = "\t"
-		columnConf.Glue = "  "
-		columnConf.NoTrim = false
-		resBody = columnize.Format(out, columnConf)
+		if len(message) != 0 {
+			resBody = message + "\n\n"
+		}
+		if autopilot != nil {
+			resBody += formatAutopilot(autopilot)
+		} else {
+			resBody += formatPeers(peers)
+		}
 		w.Header().Set("Content-Type", "text/plain")
 		w.Write([]byte(resBody))
 	} else {
 		var peersList []Peer
-		for _, v := range peers.Servers {
-			raftProtocol, state := getInfo(v)
-			peer := Peer{
-				Node:         &v.Node,
-				ID:           &v.ID,
-				Address:      &v.Address,
-				State:        state,
-				Voter:        &v.Voter,
-				RaftProtocol: raftProtocol,
+		if peers != nil {
+			for _, v := range peers.Servers {
+				raftProtocol, state := getInfo(v)
+				peer := Peer{
+					Node:         &v.Node,
+					ID:           &v.ID,
+					Address:      &v.Address,
+					State:        state,
+					Voter:        &v.Voter,
+					RaftProtocol: raftProtocol,
+				}
+				peersList = append(peersList, peer)
 			}
-			peersList = append(peersList, peer)
 		}
 		jsonResponse := Response{
-			Payload: peersList,
-			Headers: r.Header,
+			Payload:   peersList,
+			Autopilot: autopilot,
+			Message:   message,
+			Headers:   r.Header,
 		}
 		resBody, err := json.Marshal(jsonResponse)
 		if err != nil {
@@ -128,6 +226,23 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func formatPeers(peers *consul.RaftConfiguration) string {
+	out := []string{"Node\tID\tAddress\tState\tVoter\tRaftProtocol"}
+	for _, v := range peers.Servers {
+		raftProtocol, state := getInfo(v)
+		out = append(
+			out,
+			fmt.Sprintf("%s\t%s\t%s\t%s\t%v\t%s",
+				v.Node, v.ID, v.Address, state, v.Voter, raftProtocol))
+	}
+	sort.Strings(out)
+	columnConf := columnize.DefaultConfig()
+	columnConf.Delim = "\t"
+	columnConf.Glue = "  "
+	columnConf.NoTrim = false
+	return columnize.Format(out, columnConf)
+}
+
 func getInfo(v *consul.RaftServer) (string, string) {
 	raftProtocol := v.ProtocolVersion
 	if raftProtocol == "" {
@@ -0,0 +1,56 @@
+package consulopraftlist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// transferLeader is `consul operator raft transfer-leader`, the api package
+// in use has no method for it. conf must be the one the client was created
+// with, so that the address, TLS and token are the same.
+func transferLeader(conf *consul.Config, id string) error {
+	u := url.URL{
+		Scheme: conf.Scheme,
+		Host:   conf.Address,
+		Path:   "/v1/operator/raft/transfer-leader",
+	}
+	if len(id) != 0 {
+		u.RawQuery = url.Values{"id": []string{id}}.Encode()
+	}
+
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if len(conf.Token) != 0 {
+		req.Header.Set("X-Consul-Token", conf.Token)
+	}
+
+	resp, err := conf.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response code: %d (%s)", resp.StatusCode, body)
+	}
+
+	result := struct{ Success bool }{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return fmt.Errorf("leadership transfer failed")
+	}
+	return nil
+}
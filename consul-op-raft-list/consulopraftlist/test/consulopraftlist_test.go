@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	consulopraftlist "github.com/efbar/more-serverless/consul-op-raft-list/consulopraftlist"
 	consul "github.com/hashicorp/consul/api"
@@ -20,16 +21,51 @@ func TestFunc(t *testing.T) {
 		aclenabled  bool
 		loglevel    string
 		contentType string
+		action      string
+		extra       map[string]interface{}
+		status      int
 	}{
 		{
 			aclenabled:  true,
 			loglevel:    "INFO",
 			contentType: "text/plain",
+			status:      http.StatusOK,
 		},
 		{
 			aclenabled:  true,
 			loglevel:    "INFO",
 			contentType: "application/json",
+			status:      http.StatusOK,
+		},
+		{
+			aclenabled:  true,
+			loglevel:    "INFO",
+			contentType: "text/plain",
+			action:      "autopilot-health",
+			status:      http.StatusOK,
+		},
+		{
+			aclenabled:  true,
+			loglevel:    "INFO",
+			contentType: "text/plain",
+			action:      "autopilot-get-config",
+			status:      http.StatusOK,
+		},
+		{
+			aclenabled:  false,
+			loglevel:    "INFO",
+			contentType: "application/json",
+			action:      "autopilot-set-config",
+			extra:       map[string]interface{}{"autopilot": map[string]interface{}{"lastContactThreshold": "500ms", "cleanupDeadServers": false}},
+			status:      http.StatusOK,
+		},
+		{
+			aclenabled:  false,
+			loglevel:    "INFO",
+			contentType: "application/json",
+			action:      "remove-peer",
+			extra:       map[string]interface{}{"address": "127.0.0.1:8300"},
+			status:      http.StatusBadRequest,
 		},
 	}
 
@@ -65,6 +101,10 @@ func TestFunc(t *testing.T) {
 
 		jsonStruct := map[string]interface{}{
 			"endpoint": conf.Address,
+			"action":   tr.action,
+		}
+		for k, v := range tr.extra {
+			jsonStruct[k] = v
 		}
 
 		// here acl token part
@@ -123,9 +163,19 @@ func TestFunc(t *testing.T) {
 
 		handler.ServeHTTP(rr, req)
 
-		if status := rr.Code; status != http.StatusOK {
+		if status := rr.Code; status != tr.status {
 			t.Errorf("handler returned wrong status code: got %v want %v",
-				status, http.StatusOK)
+				status, tr.status)
+		}
+
+		if tr.action == "autopilot-set-config" {
+			res := consulopraftlist.Response{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("can't parse response: %s", err)
+			}
+			if res.Autopilot == nil || res.Autopilot.Config.LastContactThreshold.Duration() != 500*time.Millisecond || res.Autopilot.Config.CleanupDeadServers {
+				t.Errorf("autopilot configuration not updated: %+v", res.Autopilot)
+			}
 		}
 
 		fmt.Printf("response body: \n%s\n", rr.Body)
@@ -0,0 +1,314 @@
+package consulsnapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	gcssnapshot "github.com/efbar/more-serverless/gcs-snapshot/gcssnapshot"
+	message "github.com/efbar/more-serverless/slack-message/slackmessage"
+	consul "github.com/hashicorp/consul/api"
+	"github.com/ryanuber/columnize"
+)
+
+const (
+	defaultPrefix   = "consul-snapshots"
+	snapshotTimeout = 10 * time.Minute
+)
+
+type RequestBody struct {
+	Token        string `json:"token"`
+	Endpoint     string `json:"endpoint"`
+	Action       string `json:"action"`
+	Bucket       string `json:"bucket,omitempty"`
+	Prefix       string `json:"prefix,omitempty"`
+	Object       string `json:"object,omitempty"`
+	Retain       int    `json:"retain,omitempty"`
+	Stale        bool   `json:"stale,omitempty"`
+	Confirm      string `json:"confirm,omitempty"`
+	JsonKeyPath  string `json:"jsonKeyPath,omitempty"`
+	SlackToken   string `json:"slackToken,omitempty"`
+	SlackChannel string `json:"slackChannel,omitempty"`
+	SlackEmoji   string `json:"slackEmoji,omitempty"`
+}
+
+type Snapshot struct {
+	Object  string `json:"object"`
+	Size    int64  `json:"size"`
+	Index   uint64 `json:"index,omitempty"`
+	Created string `json:"created,omitempty"`
+}
+
+type Payload struct {
+	Snapshot  *Snapshot  `json:"snapshot,omitempty"`
+	Snapshots []Snapshot `json:"snapshots,omitempty"`
+	Pruned    []string   `json:"pruned,omitempty"`
+	Message   string     `json:"message,omitempty"`
+}
+
+type Response struct {
+	Payload Payload             `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	switch rb.Action {
+	case "save", "", "list", "download":
+	case "restore":
+		if rb.Confirm != "restore" {
+			fmt.Println("restore not confirmed")
+			http.Error(w, "restore must be confirmed with \"confirm\": \"restore\"", http.StatusBadRequest)
+			return
+		}
+		if len(rb.Object) == 0 {
+			fmt.Println("empty object")
+			http.Error(w, "empty object", http.StatusBadRequest)
+			return
+		}
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Bucket) == 0 && rb.Action != "download" {
+		fmt.Println("empty bucket")
+		http.Error(w, "empty bucket", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Prefix) == 0 {
+		rb.Prefix = defaultPrefix
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+
+	// the download is the snapshot itself, no bucket involved
+	if rb.Action == "download" {
+		client, err := newClient(&rb)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		downloadSnapshot(ctx, w, client, &rb)
+		return
+	}
+
+	storageClient, err := gcssnapshot.NewClient(ctx, rb.JsonKeyPath)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer storageClient.Close()
+
+	payload := Payload{}
+	switch rb.Action {
+	case "list":
+		payload.Snapshots, err = listSnapshots(ctx, storageClient, &rb)
+		if err != nil {
+			fmt.Println("Error listing snapshots:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case "save", "":
+		client, err := newClient(&rb)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		payload.Snapshot, err = saveSnapshot(ctx, client, storageClient, &rb)
+		if err != nil {
+			fmt.Println("Error saving snapshot:", err.Error())
+			notifyFailure(&rb, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload.Message = fmt.Sprintf("Success! Snapshot of %s saved to gs://%s/%s", rb.Endpoint, rb.Bucket, payload.Snapshot.Object)
+
+		if rb.Retain > 0 {
+			payload.Pruned, err = pruneSnapshots(ctx, storageClient, &rb)
+			if err != nil {
+				fmt.Println("Error pruning snapshots:", err.Error())
+				payload.Message += fmt.Sprintf("\nPruning failed: %s", err)
+			}
+		}
+
+	case "restore":
+		client, err := newClient(&rb)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := restoreSnapshot(ctx, client, storageClient, &rb); err != nil {
+			fmt.Println("Error restoring snapshot:", err.Error())
+			notifyFailure(&rb, err)
+			status := http.StatusInternalServerError
+			if errors.Is(err, gcssnapshot.ErrNotSnapshot) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		payload.Message = fmt.Sprintf("Success! Snapshot gs://%s/%s restored on %s", rb.Bucket, rb.Object, rb.Endpoint)
+	}
+
+	resBody := formatPayload(&payload)
+
+	if len(rb.SlackToken) > 0 && len(rb.SlackChannel) > 0 && rb.Action != "list" {
+		slackNotification(&rb, resBody)
+	}
+
+	if r.Header.Get("Content-Type") == "text/plain" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+// downloadSnapshot streams the snapshot as the response body, to be saved
+// as a file and restored with `consul snapshot restore`.
+func downloadSnapshot(ctx context.Context, w http.ResponseWriter, client *consul.Client, rb *RequestBody) {
+	snap, meta, err := client.Snapshot().Save((&consul.QueryOptions{AllowStale: rb.Stale}).WithContext(ctx))
+	if err != nil {
+		fmt.Println("Error saving snapshot:", err.Error())
+		notifyFailure(rb, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer snap.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", gcssnapshot.FileName(snapshotName)))
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(meta.LastIndex, 10))
+
+	// the status is already sent, a failure can only be logged
+	if _, err := io.Copy(w, snap); err != nil {
+		fmt.Println("Error sending snapshot:", err.Error())
+		notifyFailure(rb, err)
+	}
+}
+
+func newClient(rb *RequestBody) (*consul.Client, error) {
+	if len(rb.Endpoint) == 0 {
+		return nil, fmt.Errorf("empty endpoint")
+	}
+
+	conf := consul.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	if rb.Token != "" {
+		conf.Token = rb.Token
+	}
+
+	return consul.NewClient(conf)
+}
+
+func formatPayload(payload *Payload) string {
+	out := []string{}
+	if len(payload.Message) != 0 {
+		out = append(out, payload.Message)
+	}
+	if payload.Snapshot != nil {
+		out = append(out, fmt.Sprintf("Size\t%s", byteSize(payload.Snapshot.Size)))
+		out = append(out, fmt.Sprintf("Index\t%d", payload.Snapshot.Index))
+	}
+	for _, object := range payload.Pruned {
+		out = append(out, fmt.Sprintf("Pruned\t%s", object))
+	}
+	if payload.Snapshots != nil {
+		out = append(out, "Object\tSize\tIndex\tCreated")
+		for _, s := range payload.Snapshots {
+			out = append(out, fmt.Sprintf("%s\t%s\t%d\t%s", s.Object, byteSize(s.Size), s.Index, s.Created))
+		}
+	}
+
+	columnConf := columnize.DefaultConfig()
+	columnConf.Delim = "\t"
+	columnConf.Glue = "    "
+	columnConf.NoTrim = false
+	return columnize.Format(out, columnConf) + "\n"
+}
+
+func byteSize(size int64) string {
+	const iecKib = 1024
+	if size < iecKib {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(iecKib), 0
+	for n := size / iecKib; n >= iecKib; n /= iecKib {
+		div *= iecKib
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func notifyFailure(rb *RequestBody, err error) {
+	if len(rb.SlackToken) > 0 && len(rb.SlackChannel) > 0 {
+		slackNotification(rb, fmt.Sprintf("%s of %s failed: %s\n", orDefault(rb.Action, "save"), rb.Endpoint, err))
+	}
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func slackNotification(rb *RequestBody, resBody string) {
+	slackToken := rb.SlackToken
+	slackChannelID := rb.SlackChannel
+	slackEmoji := rb.SlackEmoji
+	slackMessage := "Consul snapshot " + slackEmoji + "\n```" + resBody + "```"
+
+	sent, err := message.Send(slackToken, slackMessage, slackChannelID)
+	if err != nil {
+		fmt.Printf("slack error: %s\n", err)
+	}
+	fmt.Println(sent)
+}
@@ -0,0 +1,86 @@
+package consulsnapshot
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"time"
+
+	storage "cloud.google.com/go/storage"
+	gcssnapshot "github.com/efbar/more-serverless/gcs-snapshot/gcssnapshot"
+	consul "github.com/hashicorp/consul/api"
+)
+
+const snapshotName = "consul-snapshot"
+
+func snapshotStore(storageClient *storage.Client, rb *RequestBody) *gcssnapshot.Store {
+	return &gcssnapshot.Store{
+		Client: storageClient,
+		Bucket: rb.Bucket,
+		Prefix: rb.Prefix,
+		Name:   snapshotName,
+	}
+}
+
+// saveSnapshot streams the snapshot straight into a new object.
+func saveSnapshot(ctx context.Context, client *consul.Client, storageClient *storage.Client, rb *RequestBody) (*Snapshot, error) {
+	snap, meta, err := client.Snapshot().Save((&consul.QueryOptions{AllowStale: rb.Stale}).WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Close()
+
+	metadata := map[string]string{
+		"consul-endpoint": rb.Endpoint,
+		"consul-index":    strconv.FormatUint(meta.LastIndex, 10),
+	}
+	object, err := snapshotStore(storageClient, rb).Save(ctx, "application/x-gzip", metadata, func(w io.Writer) error {
+		_, err := io.Copy(w, snap)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{
+		Object:  object.Name,
+		Size:    object.Size,
+		Index:   meta.LastIndex,
+		Created: object.Created.Format(time.RFC3339),
+	}, nil
+}
+
+func restoreSnapshot(ctx context.Context, client *consul.Client, storageClient *storage.Client, rb *RequestBody) error {
+	rc, err := snapshotStore(storageClient, rb).Open(ctx, rb.Object)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return client.Snapshot().Restore((&consul.WriteOptions{}).WithContext(ctx), rc)
+}
+
+// listSnapshots returns the snapshots under the prefix, newest first.
+func listSnapshots(ctx context.Context, storageClient *storage.Client, rb *RequestBody) ([]Snapshot, error) {
+	objects, err := snapshotStore(storageClient, rb).List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []Snapshot{}
+	for _, o := range objects {
+		index, _ := strconv.ParseUint(o.Metadata["consul-index"], 10, 64)
+		snapshots = append(snapshots, Snapshot{
+			Object:  o.Name,
+			Size:    o.Size,
+			Index:   index,
+			Created: o.Created.Format(time.RFC3339),
+		})
+	}
+	return snapshots, nil
+}
+
+// pruneSnapshots deletes every snapshot but the newest rb.Retain ones.
+func pruneSnapshots(ctx context.Context, storageClient *storage.Client, rb *RequestBody) ([]string, error) {
+	return snapshotStore(storageClient, rb).Prune(ctx, rb.Retain)
+}
@@ -0,0 +1,103 @@
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	consulsnapshot "github.com/efbar/more-serverless/consul-snapshot/consulsnapshot"
+	consul "github.com/hashicorp/consul/api"
+	testutil "github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+)
+
+func TestFunc(t *testing.T) {
+
+	var server *testutil.TestServer
+	var err error
+	retry.RunWith(retry.ThreeTimes(), t, func(r *retry.R) {
+		server, err = testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+			c.LogLevel = "INFO"
+			c.NodeName = "testnode"
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err.Error())
+	}
+	defer server.Stop()
+	server.WaitForSerfCheck(t)
+
+	if server.Config.Bootstrap {
+		server.WaitForLeader(t)
+	}
+
+	conf := consul.DefaultConfig()
+	conf.Address = "http://" + server.HTTPAddr
+
+	tt := []struct {
+		contentType string
+		request     map[string]interface{}
+		status      int
+	}{
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "save"},
+			status:      http.StatusBadRequest,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "restore", "bucket": "consul-backups", "object": "consul-snapshots/consul-snapshot-20210601-030000.snap"},
+			status:      http.StatusBadRequest,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "restore", "bucket": "consul-backups", "confirm": "restore"},
+			status:      http.StatusBadRequest,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "inspect"},
+			status:      http.StatusBadRequest,
+		},
+		{
+			contentType: "application/json",
+			request:     map[string]interface{}{"action": "download"},
+			status:      http.StatusOK,
+		},
+	}
+
+	for _, tr := range tt {
+		t.Log(tr.request)
+
+		tr.request["endpoint"] = conf.Address
+
+		jsonBody, _ := json.Marshal(tr.request)
+		req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+		req.Header.Set("Content-Type", tr.contentType)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(consulsnapshot.Serve)
+
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tr.status {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, tr.status)
+		}
+
+		if tr.request["action"] == "download" {
+			// snapshots are gzipped archives
+			if !bytes.HasPrefix(rr.Body.Bytes(), []byte{0x1f, 0x8b}) {
+				t.Errorf("download is not a snapshot: %d bytes", rr.Body.Len())
+			}
+			fmt.Printf("response headers: \n%v\n", rr.Header())
+			continue
+		}
+
+		fmt.Printf("response body: \n%s\n", rr.Body)
+	}
+}
@@ -0,0 +1,12 @@
+package function
+
+import (
+	"net/http"
+
+	consulsnapshot "github.com/efbar/more-serverless/consul-snapshot/consulsnapshot"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+
+	consulsnapshot.Serve(w, r)
+}
@@ -0,0 +1,227 @@
+// Package consulwatch streams the changes seen by a Consul blocking query,
+// for the functions accepting "watch": true.
+package consulwatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+const (
+	defaultWatchTimeout = 5 * time.Minute
+	maxWatchTimeout     = time.Hour
+	// consul caps blocking queries to 10 minutes anyway
+	maxWaitTime = 10 * time.Minute
+	retryWait   = time.Second
+)
+
+// Change is a value that changed between two blocking query results.
+type Change struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Event is sent for the first result of a watch, as a snapshot, and then for
+// every change, as a diff of the previous result.
+type Event struct {
+	Type    string            `json:"type"`
+	Index   uint64            `json:"index"`
+	Time    time.Time         `json:"time"`
+	Added   map[string]string `json:"added,omitempty"`
+	Removed map[string]string `json:"removed,omitempty"`
+	Changed map[string]Change `json:"changed,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// FetchFunc runs a blocking query with q and returns what it read, as a
+// value for each key, with the index to wait on next.
+type FetchFunc func(q *consul.QueryOptions) (map[string]string, uint64, error)
+
+// ParseWatchTimeout returns how long to watch for, five minutes if s is
+// empty.
+func ParseWatchTimeout(s string) (time.Duration, error) {
+	if len(s) == 0 {
+		return defaultWatchTimeout, nil
+	}
+	timeout, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if timeout <= 0 || timeout > maxWatchTimeout {
+		return 0, fmt.Errorf("watchTimeout must be between 0 and %s", maxWatchTimeout)
+	}
+	return timeout, nil
+}
+
+// Watch runs fetch as a blocking query until timeout, or until the caller
+// goes away, streaming events as Server-Sent Events if asked for with
+// text/event-stream, as newline delimited json otherwise. Every change is
+// passed to notify too. Changes are found on the whole values, values longer
+// than maxValue are only cut in the events, 0 keeping them whole.
+func Watch(w http.ResponseWriter, r *http.Request, timeout time.Duration, fetch FetchFunc, notify func(*Event), maxValue int) {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	sse := r.Header.Get("Accept") == "text/event-stream" || r.Header.Get("Content-Type") == "text/event-stream"
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	deadline, _ := ctx.Deadline()
+	var index uint64
+	var state map[string]string
+	for {
+		waitTime := time.Until(deadline)
+		if waitTime > maxWaitTime {
+			waitTime = maxWaitTime
+		}
+		q := &consul.QueryOptions{WaitIndex: index, WaitTime: waitTime}
+		current, next, err := fetch(q.WithContext(ctx))
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			fmt.Println("watch error:", err.Error())
+			writeEvent(w, sse, &Event{Type: "error", Index: index, Time: time.Now(), Error: err.Error()})
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryWait):
+			}
+			continue
+		}
+
+		// the index can go backwards when the raft state is reset, then the
+		// new one is just as good; it must be at least 1 for the query to
+		// block at all
+		index = next
+		if index < 1 {
+			index = 1
+		}
+
+		if state == nil {
+			writeEvent(w, sse, cut(&Event{Type: "snapshot", Index: index, Time: time.Now(), Added: current}, maxValue))
+			state = current
+			continue
+		}
+		e := diff(state, current)
+		state = current
+		if e == nil {
+			continue
+		}
+		e.Index = index
+		e = cut(e, maxValue)
+		writeEvent(w, sse, e)
+		notify(e)
+	}
+
+	writeEvent(w, sse, &Event{Type: "end", Index: index, Time: time.Now()})
+}
+
+// diff returns the change event from previous to current, nil if nothing
+// changed.
+func diff(previous, current map[string]string) *Event {
+	e := &Event{
+		Type:    "change",
+		Time:    time.Now(),
+		Added:   map[string]string{},
+		Removed: map[string]string{},
+		Changed: map[string]Change{},
+	}
+	for k, v := range current {
+		old, ok := previous[k]
+		switch {
+		case !ok:
+			e.Added[k] = v
+		case old != v:
+			e.Changed[k] = Change{From: old, To: v}
+		}
+	}
+	for k, v := range previous {
+		if _, ok := current[k]; !ok {
+			e.Removed[k] = v
+		}
+	}
+	if len(e.Added) == 0 && len(e.Removed) == 0 && len(e.Changed) == 0 {
+		return nil
+	}
+	return e
+}
+
+// cut returns a copy of e with the values longer than max cut, the state
+// the next changes are found against keeps the whole ones.
+func cut(e *Event, max int) *Event {
+	if max <= 0 {
+		return e
+	}
+	cutValue := func(v string) string {
+		if len(v) > max {
+			return v[:max] + " ..."
+		}
+		return v
+	}
+	cutValues := func(values map[string]string) map[string]string {
+		if values == nil {
+			return nil
+		}
+		out := map[string]string{}
+		for k, v := range values {
+			out[k] = cutValue(v)
+		}
+		return out
+	}
+
+	c := *e
+	c.Added = cutValues(e.Added)
+	c.Removed = cutValues(e.Removed)
+	if e.Changed != nil {
+		c.Changed = map[string]Change{}
+		for k, ch := range e.Changed {
+			c.Changed[k] = Change{From: cutValue(ch.From), To: cutValue(ch.To)}
+		}
+	}
+	return &c
+}
+
+func writeEvent(w http.ResponseWriter, sse bool, e *Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if sse {
+		fmt.Fprintf(w, "event: %s\nid: %d\ndata: %s\n\n", e.Type, e.Index, data)
+	} else {
+		w.Write(append(data, '\n'))
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// String prints a change like a diff, one line per key.
+func (e *Event) String() string {
+	lines := []string{}
+	for k, v := range e.Added {
+		lines = append(lines, fmt.Sprintf("+ %s: %s", k, v))
+	}
+	for k, v := range e.Removed {
+		lines = append(lines, fmt.Sprintf("- %s: %s", k, v))
+	}
+	for k, c := range e.Changed {
+		lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", k, c.From, c.To))
+	}
+	// sorted by key, whatever the kind of change
+	sort.Slice(lines, func(i, j int) bool { return lines[i][2:] < lines[j][2:] })
+	return strings.Join(lines, "\n")
+}
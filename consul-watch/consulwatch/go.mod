@@ -0,0 +1,5 @@
+module github.com/efbar/more-serverless/consul-watch/consulwatch
+
+go 1.16
+
+require github.com/hashicorp/consul/api v1.8.1
@@ -2,4 +2,11 @@ module github.com/efbar/more-serverless/gce-toggle/gcetoggle
 
 go 1.16
 
-require google.golang.org/api v0.44.0
+require (
+	github.com/efbar/more-serverless/consul-lock/consullock v0.0.0-00010101000000-000000000000
+	github.com/hashicorp/consul/api v1.8.1
+	github.com/hashicorp/consul/sdk v0.7.0
+	google.golang.org/api v0.44.0
+)
+
+replace github.com/efbar/more-serverless/consul-lock/consullock => ../../consul-lock/consullock
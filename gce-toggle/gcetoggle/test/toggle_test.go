@@ -6,10 +6,14 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
 	toggle "github.com/efbar/more-serverless/gce-toggle/gcetoggle"
+	consul "github.com/hashicorp/consul/api"
+	testutil "github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
 )
 
 var jsonkeyPath string
@@ -52,3 +56,62 @@ func TestFunc(t *testing.T) {
 		fmt.Printf("response body: \n%s\n", rr.Body)
 	}
 }
+
+func TestLock(t *testing.T) {
+
+	var server *testutil.TestServer
+	var err error
+	retry.RunWith(retry.ThreeTimes(), t, func(r *retry.R) {
+		server, err = testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+			c.LogLevel = "INFO"
+			c.NodeName = "testnode"
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err.Error())
+	}
+	defer server.Stop()
+	server.WaitForSerfCheck(t)
+
+	conf := consul.DefaultConfig()
+	conf.Address = "http://" + server.HTTPAddr
+
+	client, err := consul.NewClient(conf)
+	if err != nil {
+		t.Fatalf("client err: %v", err)
+	}
+
+	os.Setenv("PROJECT_ID", "project")
+	os.Setenv("REGION", "region")
+	os.Setenv("LOCK_ENDPOINT", conf.Address)
+	defer os.Unsetenv("LOCK_ENDPOINT")
+
+	// another toggle is running
+	lock, err := client.LockKey("more-serverless/locks/gce-toggle/project/region")
+	if err != nil {
+		t.Fatalf("lock err: %v", err)
+	}
+	if _, err := lock.Lock(nil); err != nil {
+		t.Fatalf("lock err: %v", err)
+	}
+	defer lock.Unlock()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Content-Type", "text/plain")
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(toggle.Serve)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusConflict)
+	}
+	if !strings.Contains(rr.Body.String(), "locked") {
+		t.Errorf("wrong error: %s", rr.Body)
+	}
+
+	fmt.Printf("response body: \n%s\n", rr.Body)
+}
@@ -2,6 +2,7 @@ package toggle
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 
+	consullock "github.com/efbar/more-serverless/consul-lock/consullock"
 	compute "google.golang.org/api/compute/v1"
 	"google.golang.org/api/option"
 )
@@ -39,6 +41,34 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 	projectId := os.Getenv("PROJECT_ID")
 	projectRegion := os.Getenv("REGION")
 
+	// two toggles at the same time cancel each other, the optional Consul
+	// lock lets only one run for a project and region
+	if lockEndpoint := os.Getenv("LOCK_ENDPOINT"); len(lockEndpoint) != 0 {
+		lockWait, err := consullock.ParseWait(os.Getenv("LOCK_WAIT"))
+		if err != nil {
+			fmt.Println("invalid LOCK_WAIT:", err.Error())
+			http.Error(w, fmt.Sprintf("invalid LOCK_WAIT: %s", err), http.StatusInternalServerError)
+			return
+		}
+		var lockToken string
+		if lockTokenFile, err := ioutil.ReadFile("/var/openfaas/secrets/consul-lock-token"); err == nil {
+			lockToken = strings.TrimSpace(string(lockTokenFile))
+		}
+		var unlock func()
+		ctx, unlock, err = consullock.Acquire(ctx, lockEndpoint, lockToken, lockWait, "gce-toggle", "gce-toggle/"+projectId+"/"+projectRegion)
+		if errors.Is(err, consullock.ErrLocked) {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			fmt.Println("lock error:", err.Error())
+			http.Error(w, fmt.Sprintf("lock error: %s", err), http.StatusInternalServerError)
+			return
+		}
+		defer unlock()
+	}
+
 	var err error
 	var secret string
 	if _, err := os.Stat("/var/openfaas/secrets/gce-sa-gcp"); err == nil {
@@ -60,7 +90,7 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	region, err := computeService.Regions.Get(projectId, projectRegion).Do()
+	region, err := computeService.Regions.Get(projectId, projectRegion).Context(ctx).Do()
 	if err != nil {
 		fmt.Println(err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -71,12 +101,23 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 	out := []string{}
 
 	for _, val := range region.Zones {
-		instances, _ := computeService.Instances.List(projectId, val[strings.LastIndex(val, "/")+1:]).Do()
+		instances, err := computeService.Instances.List(projectId, val[strings.LastIndex(val, "/")+1:]).Context(ctx).Do()
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		for _, v := range instances.Items {
+			// a lost lock cancels ctx, no other instance is toggled then
+			if err := ctx.Err(); err != nil {
+				fmt.Println("stopped:", err.Error())
+				http.Error(w, fmt.Sprintf("stopped: %s", err), http.StatusInternalServerError)
+				return
+			}
 			out = append(out, "Status of "+v.Name+" is "+v.Status)
 			instanceId = v.Id
 			if v.Status == "TERMINATED" || v.Status == "STOPPED" {
-				started, err := computeService.Instances.Start(projectId, v.Zone[strings.LastIndex(v.Zone, "/")+1:], strconv.FormatUint(instanceId, 10)).Do()
+				started, err := computeService.Instances.Start(projectId, v.Zone[strings.LastIndex(v.Zone, "/")+1:], strconv.FormatUint(instanceId, 10)).Context(ctx).Do()
 				if err != nil {
 					fmt.Println(err.Error())
 					http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -86,7 +127,7 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 					out = append(out, ", turning "+v.Name+" ON!\n")
 				}
 			} else {
-				stopped, err := computeService.Instances.Stop(projectId, v.Zone[strings.LastIndex(v.Zone, "/")+1:], strconv.FormatUint(instanceId, 10)).Do()
+				stopped, err := computeService.Instances.Stop(projectId, v.Zone[strings.LastIndex(v.Zone, "/")+1:], strconv.FormatUint(instanceId, 10)).Context(ctx).Do()
 				if err != nil {
 					fmt.Println(err.Error())
 					http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -99,7 +140,7 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	instanceGroupList, err := computeService.RegionInstanceGroupManagers.List(projectId, projectRegion).Do()
+	instanceGroupList, err := computeService.RegionInstanceGroupManagers.List(projectId, projectRegion).Context(ctx).Do()
 	if err != nil {
 		fmt.Println(err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -107,8 +148,13 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, v := range instanceGroupList.Items {
+		if err := ctx.Err(); err != nil {
+			fmt.Println("stopped:", err.Error())
+			http.Error(w, fmt.Sprintf("stopped: %s", err), http.StatusInternalServerError)
+			return
+		}
 		if v.TargetSize != 0 {
-			instanceGroup, err := computeService.RegionInstanceGroupManagers.Resize(projectId, projectRegion, v.Name, 0).Do()
+			instanceGroup, err := computeService.RegionInstanceGroupManagers.Resize(projectId, projectRegion, v.Name, 0).Context(ctx).Do()
 			if err != nil {
 				fmt.Println(err.Error())
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -118,7 +164,7 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 				out = append(out, "Scaling "+v.Name+" DOWN to zero instances!\n")
 			}
 		} else {
-			instanceGroup, err := computeService.RegionInstanceGroupManagers.Resize(projectId, projectRegion, v.Name, 3).Do()
+			instanceGroup, err := computeService.RegionInstanceGroupManagers.Resize(projectId, projectRegion, v.Name, 3).Context(ctx).Do()
 			if err != nil {
 				fmt.Println(err.Error())
 				http.Error(w, err.Error(), http.StatusInternalServerError)
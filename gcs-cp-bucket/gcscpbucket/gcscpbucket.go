@@ -3,6 +3,7 @@ package gcscpbucket
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -11,19 +12,21 @@ import (
 	"time"
 
 	storage "cloud.google.com/go/storage"
+	consullock "github.com/efbar/more-serverless/consul-lock/consullock"
 	message "github.com/efbar/more-serverless/slack-message/slackmessage"
 	iterator "google.golang.org/api/iterator"
 	option "google.golang.org/api/option"
 )
 
 type RequestBody struct {
-	SrcBucket    string `json:"srcBucket"`
-	DstBucket    string `json:"dstBucket"`
-	ProjectId    string `json:"projectId"`
-	JsonKeyPath  string `json:"jsonKeyPath,omitempty"`
-	SlackToken   string `json:"slackToken,omitempty"`
-	SlackChannel string `json:"slackChannel,omitempty"`
-	SlackEmoji   string `json:"slackEmoji,omitempty"`
+	SrcBucket    string              `json:"srcBucket"`
+	DstBucket    string              `json:"dstBucket"`
+	ProjectId    string              `json:"projectId"`
+	JsonKeyPath  string              `json:"jsonKeyPath,omitempty"`
+	Lock         *consullock.Options `json:"lock,omitempty"`
+	SlackToken   string              `json:"slackToken,omitempty"`
+	SlackChannel string              `json:"slackChannel,omitempty"`
+	SlackEmoji   string              `json:"slackEmoji,omitempty"`
 }
 
 type Result struct {
@@ -88,6 +91,32 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx := context.Background()
+
+	// both buckets are locked, a copy must not run while either is copied
+	// to or removed
+	if rb.Lock != nil && len(rb.Lock.Endpoint) != 0 {
+		lockWait, err := consullock.ParseWait(rb.Lock.Wait)
+		if err != nil {
+			fmt.Println("invalid lock wait:", err.Error())
+			http.Error(w, fmt.Sprintf("invalid lock wait: %s", err), http.StatusBadRequest)
+			return
+		}
+		var unlock func()
+		ctx, unlock, err = consullock.Acquire(ctx, rb.Lock.Endpoint, rb.Lock.Token, lockWait, "gcs-cp-bucket", "gcs-bucket/"+srcBucket, "gcs-bucket/"+dstBucket)
+		if errors.Is(err, consullock.ErrLocked) {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			fmt.Println("lock error:", err.Error())
+			http.Error(w, fmt.Sprintf("lock error: %s", err), http.StatusInternalServerError)
+			return
+		}
+		defer unlock()
+	}
+
 	googleCreds := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
 
 	var serviceAccountPath string
@@ -106,7 +135,6 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var storageClient *storage.Client
-	ctx := context.Background()
 
 	if len(jsonKey) != 0 {
 		storageClient, err = storage.NewClient(ctx, option.WithCredentialsFile(rb.JsonKeyPath))
@@ -4,6 +4,9 @@ go 1.16
 
 require (
 	cloud.google.com/go/storage v1.15.0
+	github.com/efbar/more-serverless/consul-lock/consullock v0.0.0-00010101000000-000000000000
 	github.com/efbar/more-serverless/slack-message/slackmessage v0.0.0-20210525171836-fe9a1d3e81b2
 	google.golang.org/api v0.47.0
 )
+
+replace github.com/efbar/more-serverless/consul-lock/consullock => ../../consul-lock/consullock
@@ -0,0 +1,103 @@
+package gcsencrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// metadata keys set on encrypted objects, everything needed to decrypt them
+// but the access to the transit key
+const (
+	metaAlgorithm   = "encryption"
+	metaWrappedKey  = "vault-transit-wrapped-key"
+	metaMount       = "vault-transit-mount"
+	metaKey         = "vault-transit-key"
+	metaContentType = "original-content-type"
+
+	algorithm = "AES256-GCM"
+)
+
+// dataKey asks transit for a new data key, returning it in plaintext and
+// wrapped by the named transit key.
+func dataKey(client *vault.Client, mount, key string) ([]byte, string, error) {
+	secret, err := client.Logical().Write(fmt.Sprintf("%s/datakey/plaintext/%s", mount, key), map[string]interface{}{
+		"bits": 256,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, "", fmt.Errorf("no data key returned")
+	}
+
+	plaintext, _ := secret.Data["plaintext"].(string)
+	wrapped, _ := secret.Data["ciphertext"].(string)
+	dk, err := base64.StdEncoding.DecodeString(plaintext)
+	if err != nil {
+		return nil, "", err
+	}
+	return dk, wrapped, nil
+}
+
+// unwrapKey decrypts a wrapped data key with the transit key.
+func unwrapKey(client *vault.Client, mount, key, wrapped string) ([]byte, error) {
+	secret, err := client.Logical().Write(fmt.Sprintf("%s/decrypt/%s", mount, key), map[string]interface{}{
+		"ciphertext": wrapped,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("no plaintext returned")
+	}
+
+	plaintext, _ := secret.Data["plaintext"].(string)
+	return base64.StdEncoding.DecodeString(plaintext)
+}
+
+// seal encrypts data with AES-256-GCM, the nonce is prepended to the result.
+// The object name is used as additional data, so that an encrypted object
+// can't be passed off as another one.
+func seal(dk []byte, name string, data []byte) ([]byte, error) {
+	gcm, err := newGCM(dk)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, []byte(name)), nil
+}
+
+func open(dk []byte, name string, data []byte) ([]byte, error) {
+	gcm, err := newGCM(dk)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted data too short")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, []byte(name))
+}
+
+func newGCM(dk []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dk)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
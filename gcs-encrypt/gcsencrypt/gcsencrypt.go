@@ -0,0 +1,363 @@
+package gcsencrypt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	storage "cloud.google.com/go/storage"
+	message "github.com/efbar/more-serverless/slack-message/slackmessage"
+	vault "github.com/hashicorp/vault/api"
+	iterator "google.golang.org/api/iterator"
+	option "google.golang.org/api/option"
+)
+
+const defaultMount = "transit"
+
+// objects bigger than this are skipped, they are encrypted in memory
+const maxObjectSize = 10 << 20
+
+type RequestBody struct {
+	Action       string `json:"action"`
+	SrcBucket    string `json:"srcBucket"`
+	DstBucket    string `json:"dstBucket"`
+	Prefix       string `json:"prefix,omitempty"`
+	JsonKeyPath  string `json:"jsonKeyPath,omitempty"`
+	Endpoint     string `json:"endpoint"`
+	Token        string `json:"token"`
+	Mount        string `json:"mount,omitempty"`
+	Key          string `json:"key,omitempty"`
+	SlackToken   string `json:"slackToken,omitempty"`
+	SlackChannel string `json:"slackChannel,omitempty"`
+	SlackEmoji   string `json:"slackEmoji,omitempty"`
+}
+
+type Result struct {
+	SrcObj    string `json:"srcObj"`
+	Completed bool   `json:"completed"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Response struct {
+	Result  []Result            `json:"result"`
+	Total   int64               `json:"totalSize"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, err := ioutil.ReadAll(r.Body)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		input = body
+	}
+
+	if len(input) == 0 {
+		fmt.Println("Json parsing error: empty body")
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.SrcBucket) == 0 || len(rb.DstBucket) == 0 {
+		fmt.Println("empty srcBucket or dstBucket value")
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+	if len(rb.Mount) == 0 {
+		rb.Mount = defaultMount
+	}
+
+	switch rb.Action {
+	case "encrypt", "":
+		if len(rb.Key) == 0 {
+			fmt.Println("empty key")
+			http.Error(w, "empty key", http.StatusBadRequest)
+			return
+		}
+	case "decrypt":
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	conf := vault.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rb.Token != "" {
+		client.SetToken(rb.Token)
+	}
+
+	serviceAccountPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if len(rb.JsonKeyPath) != 0 {
+		serviceAccountPath = rb.JsonKeyPath
+		fmt.Printf("using jsonKeyPath value %s\n", rb.JsonKeyPath)
+	} else {
+		fmt.Printf("using google creds environment value %s\n", serviceAccountPath)
+	}
+
+	var storageClient *storage.Client
+	ctx := context.Background()
+
+	if _, statErr := os.Stat(serviceAccountPath); len(serviceAccountPath) != 0 && statErr == nil {
+		storageClient, err = storage.NewClient(ctx, option.WithCredentialsFile(serviceAccountPath))
+	} else {
+		fmt.Println("jsonkey empty, not using creds option")
+		storageClient, err = storage.NewClient(ctx)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer storageClient.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
+	defer cancel()
+
+	srcBkt := storageClient.Bucket(rb.SrcBucket).Objects(ctx, &storage.Query{Prefix: rb.Prefix})
+
+	srcObjList := []Result{}
+	var totSize int64
+	completed := 0
+	failed := 0
+
+	for {
+		attrs, err := srcBkt.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			fmt.Printf("Bucket(%q).Objects: %v\n", rb.SrcBucket, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res := Result{SrcObj: attrs.Name}
+		if rb.Action == "decrypt" {
+			err = decryptObject(ctx, client, storageClient, &rb, attrs, &res)
+		} else {
+			err = encryptObject(ctx, client, storageClient, &rb, attrs, &res)
+		}
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+			failed++
+			fmt.Printf("Object(%s) %s error: %v\n", attrs.Name, orDefault(rb.Action, "encrypt"), err)
+		case !res.Skipped:
+			res.Completed = true
+			completed++
+			totSize = totSize + attrs.Size
+		}
+		srcObjList = append(srcObjList, res)
+	}
+
+	resBody := fmt.Sprintf("%s completed over %d objects/%s, %d skipped, %d failed.\n",
+		orDefault(rb.Action, "encrypt"), completed, byteSize(totSize), len(srcObjList)-completed-failed, failed)
+	if r.Header.Get("Content-Type") == "text/plain" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		jsonResponse := Response{
+			Result:  srcObjList,
+			Total:   totSize,
+			Headers: r.Header,
+		}
+		res, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(res)
+	}
+	if len(rb.SlackToken) > 0 && len(rb.SlackChannel) > 0 {
+		slackNotification(&rb, resBody)
+	}
+}
+
+// encryptObject copies an object encrypting it with a new data key, the
+// data key is stored in the object metadata wrapped by the transit key.
+// Objects already encrypted are skipped.
+func encryptObject(ctx context.Context, client *vault.Client, storageClient *storage.Client, rb *RequestBody, attrs *storage.ObjectAttrs, res *Result) error {
+	if _, ok := attrs.Metadata[metaWrappedKey]; ok {
+		res.Skipped, res.Reason = true, "already encrypted"
+		return nil
+	}
+	if tooBig(attrs, res) {
+		return nil
+	}
+
+	data, err := readObject(ctx, storageClient, rb.SrcBucket, attrs.Name)
+	if err != nil {
+		return err
+	}
+
+	dk, wrapped, err := dataKey(client, rb.Mount, rb.Key)
+	if err != nil {
+		return err
+	}
+	defer zero(dk)
+
+	sealed, err := seal(dk, attrs.Name, data)
+	if err != nil {
+		return err
+	}
+
+	metadata := map[string]string{}
+	for k, v := range attrs.Metadata {
+		metadata[k] = v
+	}
+	metadata[metaAlgorithm] = algorithm
+	metadata[metaWrappedKey] = wrapped
+	metadata[metaMount] = rb.Mount
+	metadata[metaKey] = rb.Key
+	metadata[metaContentType] = attrs.ContentType
+
+	return writeObject(ctx, storageClient, rb.DstBucket, attrs.Name, "application/octet-stream", metadata, sealed)
+}
+
+// decryptObject copies an encrypted object back in plaintext, using the
+// transit mount and key recorded in its metadata. Objects not encrypted
+// are skipped.
+func decryptObject(ctx context.Context, client *vault.Client, storageClient *storage.Client, rb *RequestBody, attrs *storage.ObjectAttrs, res *Result) error {
+	wrapped, ok := attrs.Metadata[metaWrappedKey]
+	if !ok {
+		res.Skipped, res.Reason = true, "not encrypted"
+		return nil
+	}
+	if tooBig(attrs, res) {
+		return nil
+	}
+	if attrs.Metadata[metaAlgorithm] != algorithm {
+		return fmt.Errorf("unsupported encryption %q", attrs.Metadata[metaAlgorithm])
+	}
+
+	mount := orDefault(attrs.Metadata[metaMount], rb.Mount)
+	key := orDefault(attrs.Metadata[metaKey], rb.Key)
+	dk, err := unwrapKey(client, mount, key, wrapped)
+	if err != nil {
+		return err
+	}
+	defer zero(dk)
+
+	data, err := readObject(ctx, storageClient, rb.SrcBucket, attrs.Name)
+	if err != nil {
+		return err
+	}
+	plaintext, err := open(dk, attrs.Name, data)
+	if err != nil {
+		return err
+	}
+
+	metadata := map[string]string{}
+	for k, v := range attrs.Metadata {
+		metadata[k] = v
+	}
+	contentType := metadata[metaContentType]
+	for _, k := range []string{metaAlgorithm, metaWrappedKey, metaMount, metaKey, metaContentType} {
+		delete(metadata, k)
+	}
+
+	return writeObject(ctx, storageClient, rb.DstBucket, attrs.Name, contentType, metadata, plaintext)
+}
+
+// tooBig marks the objects bigger than maxObjectSize as skipped: they would
+// be held in memory twice, as read and as encrypted or decrypted.
+func tooBig(attrs *storage.ObjectAttrs, res *Result) bool {
+	if attrs.Size <= maxObjectSize {
+		return false
+	}
+	res.Skipped = true
+	res.Reason = fmt.Sprintf("bigger than %s", byteSize(maxObjectSize))
+	return true
+}
+
+func readObject(ctx context.Context, storageClient *storage.Client, bucket, name string) ([]byte, error) {
+	rc, err := storageClient.Bucket(bucket).Object(name).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+func writeObject(ctx context.Context, storageClient *storage.Client, bucket, name, contentType string, metadata map[string]string, data []byte) error {
+	wc := storageClient.Bucket(bucket).Object(name).NewWriter(ctx)
+	wc.ContentType = contentType
+	wc.Metadata = metadata
+	if _, err := wc.Write(data); err != nil {
+		wc.Close()
+		return err
+	}
+	return wc.Close()
+}
+
+func byteSize(size int64) string {
+	const iecKib = 1024
+	if size < iecKib {
+		return fmt.Sprintf("%d", size)
+	}
+	div, exp := int64(iecKib), 0
+	for n := size / iecKib; n >= iecKib; n /= iecKib {
+		div *= iecKib
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func slackNotification(rb *RequestBody, resBody string) {
+	slackToken := rb.SlackToken
+	slackChannelID := rb.SlackChannel
+	slackEmoji := rb.SlackEmoji
+	slackMessage := "GCP's message " + slackEmoji + "\n```" + resBody + "```"
+
+	sent, err := message.Send(slackToken, slackMessage, slackChannelID)
+	if err != nil {
+		fmt.Printf("slack error: %s\n", err)
+	}
+	fmt.Println(sent)
+}
@@ -0,0 +1,12 @@
+module github.com/efbar/more-serverless/gcs-encrypt/gcsencrypt
+
+go 1.16
+
+require (
+	cloud.google.com/go/storage v1.15.0
+	github.com/efbar/more-serverless/slack-message/slackmessage v0.0.0-00010101000000-000000000000
+	github.com/hashicorp/vault/api v1.1.0
+	google.golang.org/api v0.47.0
+)
+
+replace github.com/efbar/more-serverless/slack-message/slackmessage => ../../slack-message/slackmessage
@@ -0,0 +1,11 @@
+package function
+
+import (
+	"net/http"
+
+	"github.com/efbar/more-serverless/gcs-encrypt/gcsencrypt"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	gcsencrypt.Serve(w, r)
+}
@@ -3,6 +3,7 @@ package gcsremovebucket
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,18 +11,20 @@ import (
 	"time"
 
 	storage "cloud.google.com/go/storage"
+	consullock "github.com/efbar/more-serverless/consul-lock/consullock"
 	message "github.com/efbar/more-serverless/slack-message/slackmessage"
 	option "google.golang.org/api/option"
 )
 
 type RequestBody struct {
-	Name         string            `json:"name"`
-	ProjectId    string            `json:"projectId"`
-	Labels       map[string]string `json:"labels,omitempty"`
-	JsonKeyPath  string            `json:"jsonKeyPath,omitempty"`
-	SlackToken   string            `json:"slackToken,omitempty"`
-	SlackChannel string            `json:"slackChannel,omitempty"`
-	SlackEmoji   string            `json:"slackEmoji,omitempty"`
+	Name         string              `json:"name"`
+	ProjectId    string              `json:"projectId"`
+	Labels       map[string]string   `json:"labels,omitempty"`
+	JsonKeyPath  string              `json:"jsonKeyPath,omitempty"`
+	Lock         *consullock.Options `json:"lock,omitempty"`
+	SlackToken   string              `json:"slackToken,omitempty"`
+	SlackChannel string              `json:"slackChannel,omitempty"`
+	SlackEmoji   string              `json:"slackEmoji,omitempty"`
 }
 
 type Payload struct {
@@ -72,6 +75,32 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx := context.Background()
+
+	// the bucket lock is shared with gcs-cp-bucket, nothing is copied from
+	// or to a bucket being removed
+	if rb.Lock != nil && len(rb.Lock.Endpoint) != 0 {
+		lockWait, err := consullock.ParseWait(rb.Lock.Wait)
+		if err != nil {
+			fmt.Println("invalid lock wait:", err.Error())
+			http.Error(w, fmt.Sprintf("invalid lock wait: %s", err), http.StatusBadRequest)
+			return
+		}
+		var unlock func()
+		ctx, unlock, err = consullock.Acquire(ctx, rb.Lock.Endpoint, rb.Lock.Token, lockWait, "gcs-remove-bucket", "gcs-bucket/"+rb.Name)
+		if errors.Is(err, consullock.ErrLocked) {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			fmt.Println("lock error:", err.Error())
+			http.Error(w, fmt.Sprintf("lock error: %s", err), http.StatusInternalServerError)
+			return
+		}
+		defer unlock()
+	}
+
 	googleCreds := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
 
 	var serviceAccountPath string
@@ -90,7 +119,6 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var storageClient *storage.Client
-	ctx := context.Background()
 
 	if len(jsonKey) != 0 {
 		storageClient, err = storage.NewClient(ctx, option.WithCredentialsFile(rb.JsonKeyPath))
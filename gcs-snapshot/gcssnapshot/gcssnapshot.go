@@ -0,0 +1,180 @@
+// Package gcssnapshot keeps the snapshots of vault-snapshot and
+// consul-snapshot in a GCS bucket, one object for every snapshot.
+package gcssnapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	storage "cloud.google.com/go/storage"
+	iterator "google.golang.org/api/iterator"
+	option "google.golang.org/api/option"
+)
+
+const (
+	snapshotSuffix = ".snap"
+	// sortable, so that the newest snapshot is the last object name, and
+	// down to the nanosecond, so that two snapshots don't get the same one
+	snapshotTimeFormat = "20060102-150405.000000000"
+)
+
+// ErrNotSnapshot is returned by Open for an object that isn't a snapshot of
+// the store.
+var ErrNotSnapshot = errors.New("not a snapshot")
+
+// Store is the set of snapshots named <Prefix>/<Name>-<time>.snap in Bucket.
+type Store struct {
+	Client *storage.Client
+	Bucket string
+	Prefix string
+	Name   string
+}
+
+// Object is a saved snapshot.
+type Object struct {
+	Name     string
+	Size     int64
+	Created  time.Time
+	Metadata map[string]string
+}
+
+type countingWriter struct {
+	w    io.Writer
+	size int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.size += int64(n)
+	return n, err
+}
+
+// NewClient returns a storage client with the service account key at
+// jsonKeyPath, or at GOOGLE_APPLICATION_CREDENTIALS, or with the default
+// credentials if there is no key.
+func NewClient(ctx context.Context, jsonKeyPath string) (*storage.Client, error) {
+	serviceAccountPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if len(jsonKeyPath) != 0 {
+		serviceAccountPath = jsonKeyPath
+		fmt.Printf("using jsonKeyPath value %s\n", jsonKeyPath)
+	}
+
+	if _, err := os.Stat(serviceAccountPath); len(serviceAccountPath) != 0 && err == nil {
+		return storage.NewClient(ctx, option.WithCredentialsFile(serviceAccountPath))
+	}
+	fmt.Println("jsonkey empty, not using creds option")
+	return storage.NewClient(ctx)
+}
+
+// FileName returns the name of a new snapshot of name, without prefix.
+func FileName(name string) string {
+	return name + "-" + time.Now().UTC().Format(snapshotTimeFormat) + snapshotSuffix
+}
+
+// Save streams what write writes straight into a new object, nothing is
+// buffered in memory or on disk. If write fails the object is not created,
+// and an object with the same name is never overwritten.
+func (s *Store) Save(ctx context.Context, contentType string, metadata map[string]string, write func(io.Writer) error) (*Object, error) {
+	name := path.Join(s.Prefix, FileName(s.Name))
+
+	// cancelling the context is the only way to abort an upload, the
+	// object is not created then
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wc := s.Client.Bucket(s.Bucket).Object(name).If(storage.Conditions{DoesNotExist: true}).NewWriter(ctx)
+	wc.ContentType = contentType
+	wc.Metadata = metadata
+
+	counter := &countingWriter{w: wc}
+	if err := write(counter); err != nil {
+		cancel()
+		wc.Close()
+		return nil, err
+	}
+	if err := wc.Close(); err != nil {
+		return nil, err
+	}
+
+	return &Object{
+		Name:     name,
+		Size:     counter.size,
+		Created:  wc.Attrs().Created,
+		Metadata: metadata,
+	}, nil
+}
+
+// Open returns a reader of the snapshot object, that must be named like
+// the snapshots of the store: anything else in the bucket is not restored.
+func (s *Store) Open(ctx context.Context, object string) (io.ReadCloser, error) {
+	if !s.isSnapshot(object) {
+		return nil, fmt.Errorf("%s: %w, want %s", object, ErrNotSnapshot, path.Join(s.Prefix, s.Name+"-*"+snapshotSuffix))
+	}
+	return s.Client.Bucket(s.Bucket).Object(object).NewReader(ctx)
+}
+
+// isSnapshot tells whether object is named <Prefix>/<Name>-*.snap.
+func (s *Store) isSnapshot(object string) bool {
+	base := path.Base(object)
+	return path.Dir(object) == path.Clean(s.Prefix) &&
+		strings.HasPrefix(base, s.Name+"-") && strings.HasSuffix(base, snapshotSuffix)
+}
+
+// List returns the snapshots under the prefix, newest first.
+func (s *Store) List(ctx context.Context) ([]Object, error) {
+	it := s.Client.Bucket(s.Bucket).Objects(ctx, &storage.Query{Prefix: strings.TrimSuffix(s.Prefix, "/") + "/"})
+
+	snapshots := []Object{}
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !s.isSnapshot(attrs.Name) {
+			continue
+		}
+		snapshots = append(snapshots, Object{
+			Name:     attrs.Name,
+			Size:     attrs.Size,
+			Created:  attrs.Created,
+			Metadata: attrs.Metadata,
+		})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Name > snapshots[j].Name
+	})
+	return snapshots, nil
+}
+
+// Prune deletes every snapshot but the newest retain ones and returns the
+// deleted object names.
+func (s *Store) Prune(ctx context.Context, retain int) ([]string, error) {
+	snapshots, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) <= retain {
+		return nil, nil
+	}
+
+	pruned := []string{}
+	for _, o := range snapshots[retain:] {
+		if err := s.Client.Bucket(s.Bucket).Object(o.Name).Delete(ctx); err != nil {
+			return pruned, fmt.Errorf("deleting %s: %s", o.Name, err)
+		}
+		pruned = append(pruned, o.Name)
+	}
+	return pruned, nil
+}
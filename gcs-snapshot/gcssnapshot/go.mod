@@ -0,0 +1,8 @@
+module github.com/efbar/more-serverless/gcs-snapshot/gcssnapshot
+
+go 1.16
+
+require (
+	cloud.google.com/go/storage v1.15.0
+	google.golang.org/api v0.47.0
+)
@@ -0,0 +1,11 @@
+package function
+
+import (
+	"net/http"
+
+	vaultcreds "github.com/efbar/more-serverless/vault-creds/vaultcreds"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	vaultcreds.Serve(w, r)
+}
@@ -0,0 +1,290 @@
+package vaultcreds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	vaultwrap "github.com/efbar/more-serverless/vault-wrap/vaultwrap"
+	vault "github.com/hashicorp/vault/api"
+	"github.com/ryanuber/columnize"
+)
+
+type RequestBody struct {
+	Token     string `json:"token"`
+	Endpoint  string `json:"endpoint"`
+	Action    string `json:"action"`
+	Engine    string `json:"engine,omitempty"`
+	Mount     string `json:"mount,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Path      string `json:"path,omitempty"`
+	GcpType   string `json:"gcpType,omitempty"`
+	LeaseID   string `json:"leaseId,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+	Increment string `json:"increment,omitempty"`
+	Force     bool   `json:"force,omitempty"`
+	WrapTTL   string `json:"wrapTtl,omitempty"`
+}
+
+type Lease struct {
+	LeaseID       string                 `json:"lease_id,omitempty"`
+	LeaseDuration int                    `json:"lease_duration"`
+	TTL           string                 `json:"ttl,omitempty"`
+	ExpireTime    string                 `json:"expire_time,omitempty"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+	Message       string                 `json:"message,omitempty"`
+}
+
+type Response struct {
+	Payload Lease               `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+var engines = map[string]string{
+	"database": "database/creds/%s",
+	"consul":   "consul/creds/%s",
+	"nomad":    "nomad/creds/%s",
+	"gcp":      "gcp/roleset/%s/%s",
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	conf := vault.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rb.Token != "" {
+		client.SetToken(rb.Token)
+	}
+
+	var lease Lease
+	switch rb.Action {
+	case "read", "":
+		path, err := credsPath(&rb)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		secret, err := client.Logical().Read(path)
+		if err != nil {
+			fmt.Printf("Error reading %s: %s\n", path, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if secret == nil {
+			fmt.Println("no secret at", path)
+			http.Error(w, fmt.Sprintf("no secret at %s", path), http.StatusNotFound)
+			return
+		}
+		lease = leaseFromSecret(secret)
+
+	case "renew":
+		if len(rb.LeaseID) == 0 {
+			fmt.Println("empty leaseId")
+			http.Error(w, "empty leaseId", http.StatusBadRequest)
+			return
+		}
+		increment, err := parseIncrement(rb.Increment)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		secret, err := client.Sys().Renew(rb.LeaseID, increment)
+		if err != nil {
+			fmt.Printf("Error renewing %s: %s\n", rb.LeaseID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if secret == nil {
+			fmt.Printf("Error renewing %s: empty response\n", rb.LeaseID)
+			http.Error(w, fmt.Sprintf("empty response renewing %s", rb.LeaseID), http.StatusInternalServerError)
+			return
+		}
+		lease = leaseFromSecret(secret)
+
+	case "revoke":
+		switch {
+		case len(rb.Prefix) != 0 && rb.Force:
+			err = client.Sys().RevokeForce(rb.Prefix)
+			lease.Message = fmt.Sprintf("Success! Force revoked any leases with prefix %s", rb.Prefix)
+		case len(rb.Prefix) != 0:
+			err = client.Sys().RevokePrefix(rb.Prefix)
+			lease.Message = fmt.Sprintf("Success! Revoked any leases with prefix %s", rb.Prefix)
+		case len(rb.LeaseID) != 0:
+			err = client.Sys().Revoke(rb.LeaseID)
+			lease.LeaseID = rb.LeaseID
+			lease.Message = fmt.Sprintf("Success! Revoked lease %s", rb.LeaseID)
+		default:
+			fmt.Println("empty leaseId and prefix")
+			http.Error(w, "one of leaseId or prefix is required", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			fmt.Println("Error revoking:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.WrapTTL) != 0 {
+		vaultwrap.Respond(w, r, client, rb.WrapTTL, lease)
+		return
+	}
+
+	resBody := ""
+	if r.Header.Get("Content-Type") == "text/plain" {
+		out := []string{}
+		if len(lease.Message) != 0 {
+			out = append(out, lease.Message)
+		} else {
+			out = append(out, "Key\tValue")
+			out = append(out, "---\t-----")
+			out = append(out, fmt.Sprintf("lease_id\t%s", lease.LeaseID))
+			out = append(out, fmt.Sprintf("lease_duration\t%s", lease.TTL))
+			out = append(out, fmt.Sprintf("lease_renewable\t%t", lease.Renewable))
+			if len(lease.ExpireTime) != 0 {
+				out = append(out, fmt.Sprintf("expire_time\t%s", lease.ExpireTime))
+			}
+			out = append(out, formatData(lease.Data)...)
+		}
+
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "    "
+		columnConf.NoTrim = false
+		resBody = columnize.Format(out, columnConf)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: lease,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+// credsPath returns the path to read credentials from: path as given, or
+// built from the secrets engine, its mount and the role.
+func credsPath(rb *RequestBody) (string, error) {
+	if len(rb.Path) != 0 {
+		return strings.Trim(rb.Path, "/"), nil
+	}
+
+	format, ok := engines[rb.Engine]
+	if !ok {
+		return "", fmt.Errorf("unknown engine %q, use database, consul, nomad, gcp or path", rb.Engine)
+	}
+	if len(rb.Role) == 0 {
+		return "", fmt.Errorf("empty role")
+	}
+
+	path := fmt.Sprintf(format, rb.Role)
+	if rb.Engine == "gcp" {
+		gcpType := rb.GcpType
+		if len(gcpType) == 0 {
+			gcpType = "token"
+		}
+		path = fmt.Sprintf(format, rb.Role, gcpType)
+	}
+
+	if mount := strings.Trim(rb.Mount, "/"); len(mount) != 0 {
+		path = mount + strings.TrimPrefix(path, rb.Engine)
+	}
+
+	return path, nil
+}
+
+// parseIncrement accepts either a number of seconds or a duration string.
+func parseIncrement(increment string) (int, error) {
+	if len(increment) == 0 {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(increment); err == nil {
+		return seconds, nil
+	}
+	d, err := time.ParseDuration(increment)
+	if err != nil {
+		return 0, fmt.Errorf("invalid increment %q", increment)
+	}
+	return int(d.Seconds()), nil
+}
+
+func leaseFromSecret(secret *vault.Secret) Lease {
+	lease := Lease{
+		LeaseID:       secret.LeaseID,
+		LeaseDuration: secret.LeaseDuration,
+		Renewable:     secret.Renewable,
+		Data:          secret.Data,
+	}
+	if secret.LeaseDuration > 0 {
+		ttl := time.Duration(secret.LeaseDuration) * time.Second
+		lease.TTL = ttl.String()
+		lease.ExpireTime = time.Now().Add(ttl).UTC().Format(time.RFC3339)
+	}
+	return lease
+}
+
+func formatData(rawData map[string]interface{}) []string {
+	keys := []string{}
+	for k := range rawData {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := []string{}
+	for _, k := range keys {
+		out = append(out, fmt.Sprintf("%s\t%v", k, rawData[k]))
+	}
+	return out
+}
@@ -0,0 +1,11 @@
+package function
+
+import (
+	"net/http"
+
+	vaultidentity "github.com/efbar/more-serverless/vault-identity/vaultidentity"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	vaultidentity.Serve(w, r)
+}
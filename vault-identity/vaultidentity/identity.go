@@ -0,0 +1,269 @@
+package vaultidentity
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+type Alias struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	MountAccessor string `json:"mount_accessor"`
+	MountPath     string `json:"mount_path,omitempty"`
+	MountType     string `json:"mount_type,omitempty"`
+}
+
+type GroupRef struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Policies  []string `json:"policies"`
+	Inherited bool     `json:"inherited"`
+}
+
+type Entity struct {
+	ID                string            `json:"id"`
+	Name              string            `json:"name"`
+	Disabled          bool              `json:"disabled"`
+	Policies          []string          `json:"policies"`
+	EffectivePolicies []string          `json:"effective_policies"`
+	Groups            []GroupRef        `json:"groups"`
+	Aliases           []Alias           `json:"aliases"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+	CreationTime      string            `json:"creation_time,omitempty"`
+	LastUpdateTime    string            `json:"last_update_time,omitempty"`
+}
+
+type Group struct {
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	Type           string            `json:"type"`
+	Policies       []string          `json:"policies"`
+	MemberEntities []string          `json:"member_entities"`
+	MemberGroups   []string          `json:"member_groups"`
+	ParentGroups   []string          `json:"parent_groups"`
+	Alias          *Alias            `json:"alias,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	CreationTime   string            `json:"creation_time,omitempty"`
+	LastUpdateTime string            `json:"last_update_time,omitempty"`
+}
+
+// lookupData builds the body of identity/lookup/entity and
+// identity/lookup/group from whichever of id, name or alias is given.
+func lookupData(client *vault.Client, rb *RequestBody) (map[string]interface{}, error) {
+	switch {
+	case len(rb.ID) != 0:
+		return map[string]interface{}{"id": rb.ID}, nil
+	case len(rb.Name) != 0:
+		return map[string]interface{}{"name": rb.Name}, nil
+	case len(rb.AliasName) != 0:
+		if len(rb.AliasMount) == 0 {
+			return nil, fmt.Errorf("aliasMount is required with aliasName")
+		}
+		accessor, err := mountAccessor(client, rb.AliasMount)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"alias_name":           rb.AliasName,
+			"alias_mount_accessor": accessor,
+		}, nil
+	}
+	return nil, fmt.Errorf("one of id, name or aliasName is required")
+}
+
+// mountAccessor accepts either an auth mount accessor or an auth mount path.
+func mountAccessor(client *vault.Client, mount string) (string, error) {
+	if strings.HasPrefix(mount, "auth_") {
+		return mount, nil
+	}
+	auths, err := client.Sys().ListAuth()
+	if err != nil {
+		return "", err
+	}
+	auth, ok := auths[strings.Trim(mount, "/")+"/"]
+	if !ok {
+		return "", fmt.Errorf("no auth method mounted at %s", mount)
+	}
+	return auth.Accessor, nil
+}
+
+func lookupEntity(client *vault.Client, data map[string]interface{}) (*Entity, error) {
+	secret, err := client.Logical().Write("identity/lookup/entity", data)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	d := secret.Data
+	entity := &Entity{
+		ID:             stringValue(d["id"]),
+		Name:           stringValue(d["name"]),
+		Policies:       stringSlice(d["policies"]),
+		Metadata:       stringMap(d["metadata"]),
+		CreationTime:   stringValue(d["creation_time"]),
+		LastUpdateTime: stringValue(d["last_update_time"]),
+		Groups:         []GroupRef{},
+		Aliases:        []Alias{},
+	}
+	entity.Disabled, _ = d["disabled"].(bool)
+
+	aliases, _ := d["aliases"].([]interface{})
+	for _, a := range aliases {
+		entity.Aliases = append(entity.Aliases, aliasFromData(a))
+	}
+
+	// group policies are what usually explains why a human can do
+	// something, so they are resolved here
+	policies := map[string]bool{}
+	for _, p := range entity.Policies {
+		policies[p] = true
+	}
+	direct := map[string]bool{}
+	for _, id := range stringSlice(d["direct_group_ids"]) {
+		direct[id] = true
+	}
+	for _, id := range append(stringSlice(d["direct_group_ids"]), stringSlice(d["inherited_group_ids"])...) {
+		group, err := readGroup(client, id)
+		if err != nil {
+			return nil, err
+		}
+		if group == nil {
+			continue
+		}
+		entity.Groups = append(entity.Groups, GroupRef{
+			ID:        group.ID,
+			Name:      group.Name,
+			Policies:  group.Policies,
+			Inherited: !direct[id],
+		})
+		for _, p := range group.Policies {
+			policies[p] = true
+		}
+	}
+
+	entity.EffectivePolicies = []string{}
+	for p := range policies {
+		entity.EffectivePolicies = append(entity.EffectivePolicies, p)
+	}
+	sort.Strings(entity.EffectivePolicies)
+
+	return entity, nil
+}
+
+func lookupGroup(client *vault.Client, data map[string]interface{}) (*Group, error) {
+	secret, err := client.Logical().Write("identity/lookup/group", data)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+	group := groupFromData(secret.Data)
+
+	// member entities are returned as ids, names are what auditors want
+	names := []string{}
+	for _, id := range group.MemberEntities {
+		name := id
+		entity, err := client.Logical().Read("identity/entity/id/" + id)
+		if err == nil && entity != nil && entity.Data != nil {
+			name = stringValue(entity.Data["name"])
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	group.MemberEntities = names
+
+	return group, nil
+}
+
+func readGroup(client *vault.Client, id string) (*Group, error) {
+	secret, err := client.Logical().Read("identity/group/id/" + id)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+	return groupFromData(secret.Data), nil
+}
+
+func groupFromData(d map[string]interface{}) *Group {
+	group := &Group{
+		ID:             stringValue(d["id"]),
+		Name:           stringValue(d["name"]),
+		Type:           stringValue(d["type"]),
+		Policies:       stringSlice(d["policies"]),
+		MemberEntities: stringSlice(d["member_entity_ids"]),
+		MemberGroups:   stringSlice(d["member_group_ids"]),
+		ParentGroups:   stringSlice(d["parent_group_ids"]),
+		Metadata:       stringMap(d["metadata"]),
+		CreationTime:   stringValue(d["creation_time"]),
+		LastUpdateTime: stringValue(d["last_update_time"]),
+	}
+	if a, ok := d["alias"].(map[string]interface{}); ok && len(a) != 0 {
+		alias := aliasFromData(a)
+		group.Alias = &alias
+	}
+	return group
+}
+
+func aliasFromData(raw interface{}) Alias {
+	a, _ := raw.(map[string]interface{})
+	return Alias{
+		ID:            stringValue(a["id"]),
+		Name:          stringValue(a["name"]),
+		MountAccessor: stringValue(a["mount_accessor"]),
+		MountPath:     stringValue(a["mount_path"]),
+		MountType:     stringValue(a["mount_type"]),
+	}
+}
+
+func listNames(client *vault.Client, kind string) ([]string, error) {
+	secret, err := client.Logical().List(fmt.Sprintf("identity/%s/name", kind))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	if secret == nil || secret.Data == nil {
+		return names, nil
+	}
+	names = stringSlice(secret.Data["keys"])
+	sort.Strings(names)
+	return names, nil
+}
+
+func stringValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func stringSlice(v interface{}) []string {
+	out := []string{}
+	raw, _ := v.([]interface{})
+	for _, item := range raw {
+		out = append(out, stringValue(item))
+	}
+	return out
+}
+
+func stringMap(v interface{}) map[string]string {
+	raw, ok := v.(map[string]interface{})
+	if !ok || len(raw) == 0 {
+		return nil
+	}
+	out := map[string]string{}
+	for k, item := range raw {
+		out[k] = stringValue(item)
+	}
+	return out
+}
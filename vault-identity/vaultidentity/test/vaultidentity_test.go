@@ -0,0 +1,263 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	network "github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/efbar/more-serverless/vault-identity/vaultidentity"
+	vault "github.com/hashicorp/vault/api"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const vaultServerPort = "1234"
+
+func TestFunc(t *testing.T) {
+
+	tt := []struct {
+		contentType string
+		action      string
+		kind        string
+		by          string
+	}{
+		{
+			contentType: "text/plain",
+			action:      "lookup",
+			by:          "name",
+		},
+		{
+			contentType: "application/json",
+			action:      "lookup",
+			by:          "alias",
+		},
+		{
+			contentType: "text/plain",
+			action:      "lookup",
+			kind:        "group",
+			by:          "name",
+		},
+		{
+			contentType: "text/plain",
+			action:      "list",
+		},
+		{
+			contentType: "application/json",
+			action:      "merge",
+			by:          "name",
+		},
+		{
+			contentType: "text/plain",
+			action:      "disable",
+			by:          "name",
+		},
+	}
+
+	cli, err := client.NewClientWithOpts()
+	if err != nil {
+		fmt.Printf("Can't instantiate docker client: %s", err.Error())
+	}
+
+	resp, err := startContainerService(cli, "vault")
+	if err != nil {
+		t.Logf("Can't create container: %s", err.Error())
+	}
+	t.Log(resp.ID)
+	defer removeContainerService(cli, resp.ID)
+
+	conf := vault.DefaultConfig()
+	conf.Address = "http://127.0.0.1:" + vaultServerPort
+	vaultClient, err := vault.NewClient(conf)
+	if err != nil {
+		t.Logf("Can't initiate client: %s", err.Error())
+	}
+
+	vaultClient.SetToken("root")
+
+	err = vaultClient.Sys().EnableAuthWithOptions("userpass", &vault.EnableAuthOptions{
+		Type: "userpass",
+	})
+	if err != nil {
+		t.Logf("Error enabling auth method: %s", err.Error())
+	}
+	auths, err := vaultClient.Sys().ListAuth()
+	if err != nil {
+		t.Fatalf("Error listing auth methods: %s", err)
+	}
+	accessor := auths["userpass/"].Accessor
+
+	ids := map[string]string{}
+	for _, name := range []string{"alice", "alice-dup"} {
+		entity, err := vaultClient.Logical().Write("identity/entity", map[string]interface{}{
+			"name":     name,
+			"policies": []string{"dev"},
+		})
+		if err != nil {
+			t.Fatalf("Error creating entity: %s", err)
+		}
+		ids[name], _ = entity.Data["id"].(string)
+	}
+
+	_, err = vaultClient.Logical().Write("identity/entity-alias", map[string]interface{}{
+		"name":           "alice",
+		"canonical_id":   ids["alice"],
+		"mount_accessor": accessor,
+	})
+	if err != nil {
+		t.Fatalf("Error creating entity alias: %s", err)
+	}
+
+	_, err = vaultClient.Logical().Write("identity/group", map[string]interface{}{
+		"name":              "auditors",
+		"policies":          []string{"audit"},
+		"member_entity_ids": []string{ids["alice"]},
+	})
+	if err != nil {
+		t.Fatalf("Error creating group: %s", err)
+	}
+
+	for _, tr := range tt {
+		t.Log(tr.action, tr.kind, tr.by)
+
+		jsonStruct := map[string]interface{}{
+			"endpoint": "http://127.0.0.1:" + vaultServerPort,
+			"token":    "root",
+			"action":   tr.action,
+			"kind":     tr.kind,
+		}
+
+		switch {
+		case tr.by == "name" && tr.kind == "group":
+			jsonStruct["name"] = "auditors"
+		case tr.by == "name":
+			jsonStruct["name"] = "alice"
+		case tr.by == "alias":
+			jsonStruct["aliasName"] = "alice"
+			jsonStruct["aliasMount"] = "userpass"
+		}
+		if tr.action == "merge" {
+			jsonStruct["fromIds"] = []string{ids["alice-dup"]}
+		}
+
+		jsonBody, _ := json.Marshal(jsonStruct)
+		req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+		req.Header.Set("Content-Type", tr.contentType)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(vaultidentity.Serve)
+
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, http.StatusOK)
+		}
+
+		if tr.by == "alias" {
+			res := vaultidentity.Response{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("can't parse response: %s", err)
+			}
+			if res.Payload.Entity == nil || len(res.Payload.Entity.EffectivePolicies) != 2 {
+				t.Errorf("group policies not resolved: %+v", res.Payload.Entity)
+			}
+		}
+
+		fmt.Printf("response body: \n%s\n", rr.Body)
+	}
+
+}
+
+func startContainerService(cli *client.Client, containerName string) (*container.ContainerCreateCreatedBody, error) {
+	// context
+	ctx := context.Background()
+
+	// config
+	config := &container.Config{
+		Image: containerName,
+		ExposedPorts: nat.PortSet{
+			"8200/tcp": struct{}{},
+		},
+		Cmd: []string{"server", "-dev", fmt.Sprintf("-dev-root-token-id=%s", "root"), "-dev-listen-address=0.0.0.0:8200"},
+	}
+
+	hostConfig := &container.HostConfig{
+		Binds: []string{
+			"/var/run/docker.sock:/var/run/docker.sock",
+		},
+		PortBindings: nat.PortMap{
+			"8200/tcp": []nat.PortBinding{
+				{
+					HostIP:   "127.0.0.1",
+					HostPort: vaultServerPort,
+				},
+			},
+		},
+		RestartPolicy: container.RestartPolicy{
+			Name: "always",
+		},
+		LogConfig: container.LogConfig{
+			Type:   "json-file",
+			Config: map[string]string{},
+		},
+	}
+
+	networkConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{},
+	}
+	gatewayConfig := &network.EndpointSettings{
+		Gateway: "gatewayname",
+	}
+	networkConfig.EndpointsConfig["bridge"] = gatewayConfig
+
+	resp, err := cli.ContainerCreate(
+		ctx,
+		config,
+		hostConfig,
+		networkConfig,
+		&v1.Platform{
+			Architecture: "amd64",
+			OS:           "linux",
+		},
+		containerName,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func removeContainerService(cli *client.Client, containerName string) {
+	ctx := context.Background()
+
+	err := cli.ContainerStop(ctx, containerName, nil)
+	if err != nil {
+		fmt.Printf("Can't stop container: %s", err.Error())
+		return
+	}
+
+	removeOptions := types.ContainerRemoveOptions{
+		RemoveVolumes: true,
+		Force:         true,
+	}
+	err = cli.ContainerRemove(ctx, containerName, removeOptions)
+	if err != nil {
+		fmt.Printf("Can't remove container: %s", err.Error())
+		return
+	}
+
+}
@@ -0,0 +1,307 @@
+package vaultidentity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/ryanuber/columnize"
+)
+
+type RequestBody struct {
+	Token      string   `json:"token"`
+	Endpoint   string   `json:"endpoint"`
+	Action     string   `json:"action"`
+	Kind       string   `json:"kind,omitempty"`
+	ID         string   `json:"id,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	AliasName  string   `json:"aliasName,omitempty"`
+	AliasMount string   `json:"aliasMount,omitempty"`
+	FromIDs    []string `json:"fromIds,omitempty"`
+	Force      bool     `json:"force,omitempty"`
+}
+
+type Payload struct {
+	Entity  *Entity  `json:"entity,omitempty"`
+	Group   *Group   `json:"group,omitempty"`
+	Names   []string `json:"names,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+type Response struct {
+	Payload Payload             `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	switch rb.Kind {
+	case "":
+		rb.Kind = "entity"
+	case "entity", "group":
+	default:
+		fmt.Println("unknown kind:", rb.Kind)
+		http.Error(w, fmt.Sprintf("unknown kind %q, use entity or group", rb.Kind), http.StatusBadRequest)
+		return
+	}
+
+	if rb.Kind == "group" && rb.Action != "" && rb.Action != "lookup" && rb.Action != "list" {
+		fmt.Println(rb.Action, "is for entities only")
+		http.Error(w, fmt.Sprintf("%s is for entities only", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	conf := vault.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rb.Token != "" {
+		client.SetToken(rb.Token)
+	}
+
+	payload := Payload{}
+	switch rb.Action {
+	case "list":
+		payload.Names, err = listNames(client, rb.Kind)
+		if err != nil {
+			fmt.Printf("Error listing %s names: %s\n", rb.Kind, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case "lookup", "":
+		data, err := lookupData(client, &rb)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if rb.Kind == "group" {
+			payload.Group, err = lookupGroup(client, data)
+		} else {
+			payload.Entity, err = lookupEntity(client, data)
+		}
+		if err != nil {
+			fmt.Printf("Error looking up %s: %s\n", rb.Kind, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if payload.Group == nil && payload.Entity == nil {
+			fmt.Println(rb.Kind, "not found")
+			http.Error(w, fmt.Sprintf("%s not found", rb.Kind), http.StatusNotFound)
+			return
+		}
+
+	case "disable", "enable":
+		entity, code, err := resolveEntity(client, &rb)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), code)
+			return
+		}
+		_, err = client.Logical().Write("identity/entity/id/"+entity.ID, map[string]interface{}{
+			"disabled": rb.Action == "disable",
+		})
+		if err != nil {
+			fmt.Printf("Error updating entity %s: %s\n", entity.ID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload.Entity, err = lookupEntity(client, map[string]interface{}{"id": entity.ID})
+		if err != nil {
+			fmt.Printf("Error looking up entity: %s\n", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload.Message = fmt.Sprintf("Success! Entity %s is now %sd", entity.Name, rb.Action)
+
+	case "merge":
+		if len(rb.FromIDs) == 0 {
+			fmt.Println("empty fromIds")
+			http.Error(w, "fromIds is required", http.StatusBadRequest)
+			return
+		}
+		entity, code, err := resolveEntity(client, &rb)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), code)
+			return
+		}
+		_, err = client.Logical().Write("identity/entity/merge", map[string]interface{}{
+			"from_entity_ids": rb.FromIDs,
+			"to_entity_id":    entity.ID,
+			"force":           rb.Force,
+		})
+		if err != nil {
+			fmt.Printf("Error merging into entity %s: %s\n", entity.ID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload.Entity, err = lookupEntity(client, map[string]interface{}{"id": entity.ID})
+		if err != nil {
+			fmt.Printf("Error looking up entity: %s\n", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload.Message = fmt.Sprintf("Success! Merged %s into entity %s", strings.Join(rb.FromIDs, ", "), entity.Name)
+
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	resBody := ""
+	if r.Header.Get("Content-Type") == "text/plain" {
+		out := []string{}
+		if len(payload.Message) != 0 {
+			out = append(out, payload.Message, "")
+		}
+		switch {
+		case payload.Entity != nil:
+			out = append(out, formatEntity(payload.Entity)...)
+		case payload.Group != nil:
+			out = append(out, formatGroup(payload.Group)...)
+		default:
+			out = append(out, "Keys")
+			out = append(out, "----")
+			out = append(out, payload.Names...)
+		}
+
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "    "
+		columnConf.NoTrim = false
+		resBody = columnize.Format(out, columnConf)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+// resolveEntity looks up the entity an action applies to, returning the
+// status code to answer with when it can't.
+func resolveEntity(client *vault.Client, rb *RequestBody) (*Entity, int, error) {
+	data, err := lookupData(client, rb)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	entity, err := lookupEntity(client, data)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if entity == nil {
+		return nil, http.StatusNotFound, fmt.Errorf("entity not found")
+	}
+	return entity, http.StatusOK, nil
+}
+
+func formatEntity(e *Entity) []string {
+	out := []string{"Key\tValue", "---\t-----"}
+	out = append(out, fmt.Sprintf("id\t%s", e.ID))
+	out = append(out, fmt.Sprintf("name\t%s", e.Name))
+	out = append(out, fmt.Sprintf("disabled\t%t", e.Disabled))
+	out = append(out, fmt.Sprintf("policies\t%s", formatList(e.Policies)))
+	out = append(out, fmt.Sprintf("effective_policies\t%s", formatList(e.EffectivePolicies)))
+	out = append(out, formatMetadata(e.Metadata)...)
+	out = append(out, "")
+
+	out = append(out, "Alias\tMount Path\tMount Type\tID")
+	for _, a := range e.Aliases {
+		out = append(out, fmt.Sprintf("%s\t%s\t%s\t%s", a.Name, a.MountPath, a.MountType, a.ID))
+	}
+	out = append(out, "")
+
+	out = append(out, "Group\tPolicies\tMembership\tID")
+	for _, g := range e.Groups {
+		membership := "direct"
+		if g.Inherited {
+			membership = "inherited"
+		}
+		out = append(out, fmt.Sprintf("%s\t%s\t%s\t%s", g.Name, formatList(g.Policies), membership, g.ID))
+	}
+	return out
+}
+
+func formatGroup(g *Group) []string {
+	out := []string{"Key\tValue", "---\t-----"}
+	out = append(out, fmt.Sprintf("id\t%s", g.ID))
+	out = append(out, fmt.Sprintf("name\t%s", g.Name))
+	out = append(out, fmt.Sprintf("type\t%s", g.Type))
+	out = append(out, fmt.Sprintf("policies\t%s", formatList(g.Policies)))
+	out = append(out, fmt.Sprintf("member_entities\t%s", formatList(g.MemberEntities)))
+	out = append(out, fmt.Sprintf("member_group_ids\t%s", formatList(g.MemberGroups)))
+	out = append(out, fmt.Sprintf("parent_group_ids\t%s", formatList(g.ParentGroups)))
+	if g.Alias != nil {
+		out = append(out, fmt.Sprintf("alias\t%s (%s)", g.Alias.Name, g.Alias.MountAccessor))
+	}
+	out = append(out, formatMetadata(g.Metadata)...)
+	return out
+}
+
+func formatMetadata(metadata map[string]string) []string {
+	keys := []string{}
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := []string{}
+	for _, k := range keys {
+		out = append(out, fmt.Sprintf("metadata.%s\t%s", k, metadata[k]))
+	}
+	return out
+}
+
+func formatList(list []string) string {
+	if len(list) == 0 {
+		return "[]"
+	}
+	return "[" + strings.Join(list, " ") + "]"
+}
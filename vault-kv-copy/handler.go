@@ -0,0 +1,11 @@
+package function
+
+import (
+	"net/http"
+
+	vaultkvcopy "github.com/efbar/more-serverless/vault-kv-copy/vaultkvcopy"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	vaultkvcopy.Serve(w, r)
+}
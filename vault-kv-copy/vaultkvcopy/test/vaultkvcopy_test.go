@@ -0,0 +1,247 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	network "github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/efbar/more-serverless/vault-kv-copy/vaultkvcopy"
+	vault "github.com/hashicorp/vault/api"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const vaultServerPort = "1234"
+
+func TestFunc(t *testing.T) {
+
+	tt := []struct {
+		contentType string
+		destination string
+		allVersions bool
+		dryRun      bool
+		written     int
+	}{
+		{
+			contentType: "text/plain",
+			destination: "secret/copy",
+			allVersions: true,
+			dryRun:      true,
+		},
+		{
+			contentType: "application/json",
+			destination: "secret/copy",
+			allVersions: true,
+			written:     3,
+		},
+		{
+			contentType: "application/json",
+			destination: "kv1/app",
+			written:     3,
+		},
+		{
+			contentType: "text/plain",
+			destination: "kv1/app",
+			allVersions: true,
+			written:     3,
+		},
+	}
+
+	cli, err := client.NewClientWithOpts()
+	if err != nil {
+		fmt.Printf("Can't instantiate docker client: %s", err.Error())
+	}
+
+	resp, err := startContainerService(cli, "vault")
+	if err != nil {
+		t.Logf("Can't create container: %s", err.Error())
+	}
+	t.Log(resp.ID)
+	defer removeContainerService(cli, resp.ID)
+
+	conf := vault.DefaultConfig()
+	conf.Address = "http://127.0.0.1:" + vaultServerPort
+	vaultClient, err := vault.NewClient(conf)
+	if err != nil {
+		t.Logf("Can't initiate client: %s", err.Error())
+	}
+
+	vaultClient.SetToken("root")
+
+	mountPath := "kv1/"
+
+	mountInput := &vault.MountInput{
+		Type: "kv",
+	}
+
+	err = vaultClient.Sys().Mount(mountPath, mountInput)
+	if err != nil {
+		t.Logf(fmt.Sprintf("Error in mounting path %s: %s", mountPath, err.Error()))
+	}
+
+	// the dev server mounts secret/ as kv version 2
+	secrets := []struct {
+		path string
+		data map[string]interface{}
+	}{
+		{"secret/data/app/db", map[string]interface{}{"password": "first"}},
+		{"secret/data/app/db", map[string]interface{}{"password": "second"}},
+		{"secret/data/app/api", map[string]interface{}{"key": "foo"}},
+		{"secret/data/app/nested/cert", map[string]interface{}{"pem": "bar"}},
+	}
+	for _, s := range secrets {
+		_, err = vaultClient.Logical().Write(s.path, map[string]interface{}{"data": s.data})
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Error writing secret: %s", err))
+		}
+	}
+
+	for _, tr := range tt {
+		t.Log(tr.destination)
+
+		jsonStruct := map[string]interface{}{
+			"endpoint":    "http://127.0.0.1:" + vaultServerPort,
+			"token":       "root",
+			"source":      "secret/app",
+			"destination": tr.destination,
+			"allVersions": tr.allVersions,
+			"dryRun":      tr.dryRun,
+		}
+
+		jsonBody, _ := json.Marshal(jsonStruct)
+		req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+		req.Header.Set("Content-Type", tr.contentType)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(vaultkvcopy.Serve)
+
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, http.StatusOK)
+		}
+
+		if tr.contentType == "application/json" {
+			res := vaultkvcopy.Response{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("can't parse response: %s", err)
+			}
+			if res.Payload.Written != tr.written {
+				t.Errorf("wrong number of secrets written: got %d want %d", res.Payload.Written, tr.written)
+			}
+		}
+
+		fmt.Printf("response body: \n%s\n", rr.Body)
+	}
+
+	copied, err := vaultClient.Logical().Read("secret/metadata/copy/db")
+	if err != nil || copied == nil {
+		t.Fatalf("copied secret not found: %v", err)
+	}
+	if v, _ := copied.Data["current_version"].(json.Number); v.String() != "2" {
+		t.Errorf("versions not copied: current_version %v", copied.Data["current_version"])
+	}
+
+	legacy, err := vaultClient.Logical().Read("kv1/app/db")
+	if err != nil || legacy == nil {
+		t.Fatalf("copied secret not found: %v", err)
+	}
+	if legacy.Data["password"] != "second" {
+		t.Errorf("wrong version copied to kv1: %v", legacy.Data["password"])
+	}
+}
+
+func startContainerService(cli *client.Client, containerName string) (*container.ContainerCreateCreatedBody, error) {
+	// context
+	ctx := context.Background()
+
+	// config
+	config := &container.Config{
+		Image: containerName,
+		ExposedPorts: nat.PortSet{
+			"8200/tcp": struct{}{},
+		},
+		Cmd: []string{"server", "-dev", fmt.Sprintf("-dev-root-token-id=%s", "root"), "-dev-listen-address=0.0.0.0:8200"},
+	}
+
+	hostConfig := &container.HostConfig{
+		Binds: []string{
+			"/var/run/docker.sock:/var/run/docker.sock",
+		},
+		PortBindings: nat.PortMap{
+			"8200/tcp": []nat.PortBinding{
+				{
+					HostIP:   "127.0.0.1",
+					HostPort: vaultServerPort,
+				},
+			},
+		},
+		RestartPolicy: container.RestartPolicy{
+			Name: "always",
+		},
+		LogConfig: container.LogConfig{
+			Type:   "json-file",
+			Config: map[string]string{},
+		},
+	}
+
+	networkConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{},
+	}
+	gatewayConfig := &network.EndpointSettings{
+		Gateway: "gatewayname",
+	}
+	networkConfig.EndpointsConfig["bridge"] = gatewayConfig
+
+	resp, err := cli.ContainerCreate(
+		ctx,
+		config,
+		hostConfig,
+		networkConfig,
+		&v1.Platform{
+			Architecture: "amd64",
+			OS:           "linux",
+		},
+		containerName,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func removeContainerService(cli *client.Client, containerName string) {
+	ctx := context.Background()
+
+	err := cli.ContainerStop(ctx, containerName, nil)
+	if err != nil {
+		fmt.Printf("Can't stop container: %s", err.Error())
+		return
+	}
+
+	removeOptions := types.ContainerRemoveOptions{
+		RemoveVolumes: true,
+		Force:         true,
+	}
+	err = cli.ContainerRemove(ctx, containerName, removeOptions)
+	if err != nil {
+		fmt.Printf("Can't remove container: %s", err.Error())
+		return
+	}
+
+}
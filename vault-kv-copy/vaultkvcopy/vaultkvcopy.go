@@ -0,0 +1,263 @@
+package vaultkvcopy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+
+	vaultkv "github.com/efbar/more-serverless/vault-kv/vaultkv"
+	vault "github.com/hashicorp/vault/api"
+	"github.com/ryanuber/columnize"
+)
+
+type RequestBody struct {
+	Token        string `json:"token"`
+	Endpoint     string `json:"endpoint"`
+	Namespace    string `json:"namespace,omitempty"`
+	Source       string `json:"source"`
+	Destination  string `json:"destination"`
+	DstToken     string `json:"dstToken,omitempty"`
+	DstEndpoint  string `json:"dstEndpoint,omitempty"`
+	DstNamespace string `json:"dstNamespace,omitempty"`
+	AllVersions  bool   `json:"allVersions,omitempty"`
+	DryRun       bool   `json:"dryRun,omitempty"`
+}
+
+type Copy struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Versions    []int  `json:"versions,omitempty"`
+	Written     bool   `json:"written"`
+	Error       string `json:"error,omitempty"`
+}
+
+type Payload struct {
+	SourceVersion      int    `json:"source_kv_version"`
+	DestinationVersion int    `json:"destination_kv_version"`
+	DryRun             bool   `json:"dry_run"`
+	Secrets            int    `json:"secrets"`
+	Written            int    `json:"written"`
+	Errors             int    `json:"errors"`
+	Copies             []Copy `json:"copies"`
+}
+
+type Response struct {
+	Payload Payload             `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Source) == 0 || len(rb.Destination) == 0 {
+		fmt.Println("empty source or destination")
+		http.Error(w, "source and destination are required", http.StatusBadRequest)
+		return
+	}
+
+	// the destination defaults to the source cluster and namespace
+	if len(rb.DstEndpoint) == 0 {
+		rb.DstEndpoint = rb.Endpoint
+	}
+	if len(rb.DstToken) == 0 {
+		rb.DstToken = rb.Token
+	}
+	if len(rb.DstNamespace) == 0 {
+		rb.DstNamespace = rb.Namespace
+	}
+
+	if rb.DstEndpoint == rb.Endpoint && rb.DstNamespace == rb.Namespace &&
+		strings.Trim(rb.Source, "/") == strings.Trim(rb.Destination, "/") {
+		fmt.Println("source and destination are the same")
+		http.Error(w, "source and destination are the same", http.StatusBadRequest)
+		return
+	}
+
+	srcClient, err := newClient(rb.Endpoint, rb.Token, rb.Namespace)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dstClient, err := newClient(rb.DstEndpoint, rb.DstToken, rb.DstNamespace)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	src, srcRoot, err := vaultkv.New(srcClient, rb.Source)
+	if err != nil {
+		fmt.Println("Error on source:", err.Error())
+		http.Error(w, fmt.Sprintf("source: %s", err), http.StatusBadRequest)
+		return
+	}
+	dst, dstRoot, err := vaultkv.New(dstClient, rb.Destination)
+	if err != nil {
+		fmt.Println("Error on destination:", err.Error())
+		http.Error(w, fmt.Sprintf("destination: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	secrets, err := src.Walk(srcRoot)
+	if err != nil {
+		fmt.Println("Error listing source:", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	payload := Payload{
+		SourceVersion:      src.Version,
+		DestinationVersion: dst.Version,
+		DryRun:             rb.DryRun,
+		Secrets:            len(secrets),
+		Copies:             []Copy{},
+	}
+	for _, rel := range secrets {
+		c := copySecret(src, dst, rel, path.Join(dstRoot, strings.TrimPrefix(rel, srcRoot)), &rb)
+		if c.Written {
+			payload.Written++
+		}
+		if len(c.Error) != 0 {
+			payload.Errors++
+		}
+		payload.Copies = append(payload.Copies, c)
+	}
+
+	resBody := ""
+	if r.Header.Get("Content-Type") == "text/plain" {
+		out := []string{"Source\tDestination\tVersions\tStatus"}
+		for _, c := range payload.Copies {
+			status := "written"
+			switch {
+			case len(c.Error) != 0:
+				status = c.Error
+			case rb.DryRun:
+				status = "would write"
+			}
+			out = append(out, fmt.Sprintf("%s\t%s\t%s\t%s",
+				src.Mount+c.Source, dst.Mount+c.Destination, formatVersions(c.Versions), status))
+		}
+		out = append(out, "")
+		out = append(out, fmt.Sprintf("KV versions\tv%d -> v%d", src.Version, dst.Version))
+		out = append(out, fmt.Sprintf("Secrets\t%d", payload.Secrets))
+		out = append(out, fmt.Sprintf("Written\t%d", payload.Written))
+		out = append(out, fmt.Sprintf("Errors\t%d", payload.Errors))
+		if rb.DryRun {
+			out = append(out, "Dry run\tnothing written")
+		}
+
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "    "
+		columnConf.NoTrim = false
+		resBody = columnize.Format(out, columnConf)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+// copySecret copies one secret. Every version is replayed in order only when
+// both sides are KV v2, otherwise the latest version is the only one copied.
+func copySecret(src, dst *vaultkv.KV, srcRel, dstRel string, rb *RequestBody) Copy {
+	c := Copy{Source: srcRel, Destination: dstRel}
+
+	versions := []int{0}
+	if rb.AllVersions && src.Version == 2 && dst.Version == 2 {
+		v, err := src.Versions(srcRel)
+		if err != nil {
+			c.Error = err.Error()
+			return c
+		}
+		if len(v) == 0 {
+			c.Error = "every version is deleted or destroyed"
+			return c
+		}
+		versions = v
+		c.Versions = v
+	}
+
+	for _, version := range versions {
+		data, _, err := src.Read(srcRel, version)
+		if err != nil {
+			c.Error = err.Error()
+			return c
+		}
+		if rb.DryRun {
+			continue
+		}
+		if err := dst.Write(dstRel, data); err != nil {
+			c.Error = err.Error()
+			return c
+		}
+	}
+
+	c.Written = !rb.DryRun
+	return c
+}
+
+func newClient(endpoint, token, namespace string) (*vault.Client, error) {
+	conf := vault.DefaultConfig()
+	conf.Address = endpoint
+
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		client.SetToken(token)
+	}
+	if namespace != "" {
+		client.SetNamespace(namespace)
+	}
+	return client, nil
+}
+
+func formatVersions(versions []int) string {
+	if len(versions) == 0 {
+		return "latest"
+	}
+	s := []string{}
+	for _, v := range versions {
+		s = append(s, fmt.Sprintf("%d", v))
+	}
+	return strings.Join(s, ",")
+}
@@ -26,6 +26,7 @@ func TestFunc(t *testing.T) {
 	tt := []struct {
 		loglevel    string
 		contentType string
+		wrapTTL     string
 	}{
 		{
 			loglevel:    "INFO",
@@ -35,6 +36,11 @@ func TestFunc(t *testing.T) {
 			loglevel:    "INFO",
 			contentType: "application/json",
 		},
+		{
+			loglevel:    "INFO",
+			contentType: "application/json",
+			wrapTTL:     "5m",
+		},
 	}
 
 	cli, err := client.NewClientWithOpts()
@@ -96,6 +102,10 @@ func TestFunc(t *testing.T) {
 
 	for _, tr := range tt {
 
+		if len(tr.wrapTTL) != 0 {
+			jsonStruct["wrapTtl"] = tr.wrapTTL
+		}
+
 		jsonBody, _ := json.Marshal(jsonStruct)
 		req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
 		req.Header.Set("Content-Type", tr.contentType)
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 
+	vaultwrap "github.com/efbar/more-serverless/vault-wrap/vaultwrap"
 	vault "github.com/hashicorp/vault/api"
 	"github.com/ryanuber/columnize"
 )
@@ -15,6 +16,7 @@ type RequestBody struct {
 	Endpoint string              `json:"endpoint"`
 	Path     string              `json:"path"`
 	Data     map[string][]string `json:"data"`
+	WrapTTL  string              `json:"wrapTtl,omitempty"`
 }
 
 type Response struct {
@@ -83,6 +85,11 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(rb.WrapTTL) != 0 {
+		vaultwrap.Respond(w, r, client, rb.WrapTTL, secret.Data)
+		return
+	}
+
 	resBody := ""
 	if r.Header.Get("Content-Type") == "text/plain" {
 		out := []string{}
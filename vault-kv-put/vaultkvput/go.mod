@@ -9,6 +9,7 @@ require (
 	github.com/docker/docker v20.10.5+incompatible
 	github.com/docker/go-connections v0.4.0
 	github.com/docker/go-units v0.4.0 // indirect
+	github.com/efbar/more-serverless/vault-wrap/vaultwrap v0.0.0-00010101000000-000000000000
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/hashicorp/vault/api v1.1.0
@@ -20,3 +21,5 @@ require (
 	github.com/sirupsen/logrus v1.8.1 // indirect
 	gotest.tools/v3 v3.0.3 // indirect
 )
+
+replace github.com/efbar/more-serverless/vault-wrap/vaultwrap => ../../vault-wrap/vaultwrap
@@ -0,0 +1,5 @@
+module github.com/efbar/more-serverless/vault-kv/vaultkv
+
+go 1.16
+
+require github.com/hashicorp/vault/api v1.1.0
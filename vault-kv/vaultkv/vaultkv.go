@@ -0,0 +1,198 @@
+// Package vaultkv walks, reads and writes the secrets of a KV secrets engine
+// mount, for the functions working on whole KV trees.
+package vaultkv
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// KV is a KV secrets engine mount, hiding the differences between version 1
+// and version 2 paths and payloads.
+type KV struct {
+	Client  *vault.Client
+	Mount   string
+	Version int
+}
+
+// New finds the mount of path and its KV version, the same way the vault
+// CLI does, and returns it with path relative to the mount.
+func New(client *vault.Client, fullPath string) (*KV, string, error) {
+	fullPath = strings.Trim(fullPath, "/")
+	if len(fullPath) == 0 {
+		return nil, "", fmt.Errorf("empty path")
+	}
+
+	secret, err := client.Logical().Read("sys/internal/ui/mounts/" + fullPath)
+	if err != nil {
+		return nil, "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, "", fmt.Errorf("no mount found for %s", fullPath)
+	}
+
+	mount, _ := secret.Data["path"].(string)
+	if mountType, _ := secret.Data["type"].(string); mountType != "kv" && mountType != "generic" {
+		return nil, "", fmt.Errorf("%s is a %s mount, not kv", mount, mountType)
+	}
+
+	version := 1
+	if options, ok := secret.Data["options"].(map[string]interface{}); ok {
+		if v, _ := options["version"].(string); v == "2" {
+			version = 2
+		}
+	}
+
+	rel := strings.TrimPrefix(fullPath+"/", mount)
+	return &KV{Client: client, Mount: mount, Version: version}, strings.Trim(rel, "/"), nil
+}
+
+func (k *KV) path(prefix, rel string) string {
+	if k.Version == 2 {
+		return k.Mount + prefix + "/" + rel
+	}
+	return k.Mount + rel
+}
+
+// Walk returns every secret under rel, rel itself if it has no children.
+func (k *KV) Walk(rel string) ([]string, error) {
+	secret, err := k.Client.Logical().List(k.path("metadata", rel))
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		if len(rel) == 0 {
+			return nil, nil
+		}
+		return []string{rel}, nil
+	}
+
+	keys, _ := secret.Data["keys"].([]interface{})
+	secrets := []string{}
+	for _, key := range keys {
+		name, _ := key.(string)
+		child := path.Join(rel, name)
+		if !strings.HasSuffix(name, "/") {
+			secrets = append(secrets, child)
+			continue
+		}
+		children, err := k.Walk(child)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, children...)
+	}
+	sort.Strings(secrets)
+	return secrets, nil
+}
+
+// Versions returns the readable versions of a KV v2 secret, oldest first:
+// deleted and destroyed versions are skipped.
+func (k *KV) Versions(rel string) ([]int, error) {
+	readable, _, err := k.versions(rel)
+	return readable, err
+}
+
+// DeletedVersions returns the versions of a KV v2 secret that are deleted but
+// not destroyed, oldest first: they can't be read, but can be undeleted.
+func (k *KV) DeletedVersions(rel string) ([]int, error) {
+	_, deleted, err := k.versions(rel)
+	return deleted, err
+}
+
+func (k *KV) versions(rel string) ([]int, []int, error) {
+	secret, err := k.Client.Logical().Read(k.path("metadata", rel))
+	if err != nil {
+		return nil, nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil, fmt.Errorf("no metadata for %s", rel)
+	}
+
+	raw, _ := secret.Data["versions"].(map[string]interface{})
+	readable := []int{}
+	deleted := []int{}
+	for v, m := range raw {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			continue
+		}
+		meta, _ := m.(map[string]interface{})
+		if destroyed, _ := meta["destroyed"].(bool); destroyed {
+			continue
+		}
+		if deletion, _ := meta["deletion_time"].(string); deletion != "" {
+			deleted = append(deleted, n)
+			continue
+		}
+		readable = append(readable, n)
+	}
+	sort.Ints(readable)
+	sort.Ints(deleted)
+	return readable, deleted, nil
+}
+
+// Read returns the data of a secret, version 0 being the latest one, and on
+// KV v2 the version actually read.
+func (k *KV) Read(rel string, version int) (map[string]interface{}, int, error) {
+	var secret *vault.Secret
+	var err error
+	if k.Version == 2 && version > 0 {
+		secret, err = k.Client.Logical().ReadWithData(k.path("data", rel), map[string][]string{
+			"version": {strconv.Itoa(version)},
+		})
+	} else {
+		secret, err = k.Client.Logical().Read(k.path("data", rel))
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, 0, fmt.Errorf("no secret at %s", rel)
+	}
+
+	if k.Version == 1 {
+		return secret.Data, 0, nil
+	}
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return nil, 0, fmt.Errorf("no data at %s, version %d", rel, version)
+	}
+	if metadata, ok := secret.Data["metadata"].(map[string]interface{}); ok {
+		if v, ok := metadata["version"].(json.Number); ok {
+			n, _ := v.Int64()
+			version = int(n)
+		}
+	}
+	return data, version, nil
+}
+
+// Write stores data as a new version of the secret.
+func (k *KV) Write(rel string, data map[string]interface{}) error {
+	if k.Version == 2 {
+		_, err := k.Client.Logical().Write(k.path("data", rel), map[string]interface{}{"data": data})
+		return err
+	}
+	_, err := k.Client.Logical().Write(k.path("data", rel), data)
+	return err
+}
+
+// WriteCAS stores data back. On KV v2 the write only succeeds if the secret
+// is still at version, so that a concurrent change isn't overwritten; KV v1
+// has no versions, the write always succeeds.
+func (k *KV) WriteCAS(rel string, data map[string]interface{}, version int) error {
+	if k.Version == 2 {
+		_, err := k.Client.Logical().Write(k.path("data", rel), map[string]interface{}{
+			"options": map[string]interface{}{"cas": version},
+			"data":    data,
+		})
+		return err
+	}
+	return k.Write(rel, data)
+}
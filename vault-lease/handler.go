@@ -0,0 +1,11 @@
+package function
+
+import (
+	"net/http"
+
+	vaultlease "github.com/efbar/more-serverless/vault-lease/vaultlease"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	vaultlease.Serve(w, r)
+}
@@ -0,0 +1,379 @@
+package vaultlease
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/ryanuber/columnize"
+)
+
+const (
+	defaultExpiringWithin = 24 * time.Hour
+	maxLeases             = 1000
+)
+
+type RequestBody struct {
+	Token          string `json:"token"`
+	Endpoint       string `json:"endpoint"`
+	Action         string `json:"action"`
+	Prefix         string `json:"prefix,omitempty"`
+	LeaseID        string `json:"leaseId,omitempty"`
+	Increment      string `json:"increment,omitempty"`
+	Force          bool   `json:"force,omitempty"`
+	Confirm        string `json:"confirm,omitempty"`
+	ExpiringWithin string `json:"expiringWithin,omitempty"`
+}
+
+type Lease struct {
+	ID           string `json:"id"`
+	IssueTime    string `json:"issue_time,omitempty"`
+	ExpireTime   string `json:"expire_time,omitempty"`
+	LastRenewal  string `json:"last_renewal,omitempty"`
+	TTL          int    `json:"ttl"`
+	Renewable    bool   `json:"renewable"`
+	ExpiringSoon bool   `json:"expiring_soon"`
+}
+
+type Payload struct {
+	Leases    []Lease `json:"leases,omitempty"`
+	Expiring  int     `json:"expiring"`
+	Truncated bool    `json:"truncated,omitempty"`
+	Message   string  `json:"message,omitempty"`
+}
+
+type Response struct {
+	Payload Payload             `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	expiringWithin := defaultExpiringWithin
+	if len(rb.ExpiringWithin) != 0 {
+		expiringWithin, err = time.ParseDuration(rb.ExpiringWithin)
+		if err != nil {
+			fmt.Println("invalid expiringWithin:", err.Error())
+			http.Error(w, fmt.Sprintf("invalid expiringWithin %q", rb.ExpiringWithin), http.StatusBadRequest)
+			return
+		}
+	}
+
+	conf := vault.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rb.Token != "" {
+		client.SetToken(rb.Token)
+	}
+
+	payload := Payload{}
+	switch rb.Action {
+	case "list", "":
+		if len(rb.Prefix) == 0 {
+			fmt.Println("empty prefix")
+			http.Error(w, "empty prefix", http.StatusBadRequest)
+			return
+		}
+		ids, truncated, err := listLeases(client, strings.Trim(rb.Prefix, "/")+"/", maxLeases)
+		if err != nil {
+			fmt.Printf("Error listing leases under %s: %s\n", rb.Prefix, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload.Truncated = truncated
+		payload.Leases = []Lease{}
+		for _, id := range ids {
+			lease, err := lookup(client, id)
+			if err != nil {
+				// the lease may have expired since it was listed
+				fmt.Printf("Error looking up %s: %s\n", id, err)
+				continue
+			}
+			payload.Leases = append(payload.Leases, lease)
+		}
+
+	case "lookup":
+		if len(rb.LeaseID) == 0 {
+			fmt.Println("empty leaseId")
+			http.Error(w, "empty leaseId", http.StatusBadRequest)
+			return
+		}
+		lease, err := lookup(client, rb.LeaseID)
+		if err != nil {
+			fmt.Printf("Error looking up %s: %s\n", rb.LeaseID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload.Leases = []Lease{lease}
+
+	case "renew":
+		if len(rb.LeaseID) == 0 {
+			fmt.Println("empty leaseId")
+			http.Error(w, "empty leaseId", http.StatusBadRequest)
+			return
+		}
+		increment, err := parseIncrement(rb.Increment)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := client.Sys().Renew(rb.LeaseID, increment); err != nil {
+			fmt.Printf("Error renewing %s: %s\n", rb.LeaseID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		lease, err := lookup(client, rb.LeaseID)
+		if err != nil {
+			fmt.Printf("Error looking up %s: %s\n", rb.LeaseID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload.Leases = []Lease{lease}
+		payload.Message = fmt.Sprintf("Success! Renewed lease %s", rb.LeaseID)
+
+	case "revoke":
+		if rb.Force && len(rb.Prefix) == 0 {
+			fmt.Println("force without prefix")
+			http.Error(w, "force only applies to a prefix revoke", http.StatusBadRequest)
+			return
+		}
+		// revoking a whole prefix must name it again
+		if len(rb.Prefix) != 0 && rb.Confirm != rb.Prefix {
+			fmt.Println("prefix revoke not confirmed")
+			http.Error(w, fmt.Sprintf("prefix revoke must be confirmed with \"confirm\": %q", rb.Prefix), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case len(rb.Prefix) != 0 && rb.Force:
+			err = client.Sys().RevokeForce(rb.Prefix)
+			payload.Message = fmt.Sprintf("Success! Force revoked any leases with prefix %s", rb.Prefix)
+		case len(rb.Prefix) != 0:
+			err = client.Sys().RevokePrefix(rb.Prefix)
+			payload.Message = fmt.Sprintf("Success! Revoked any leases with prefix %s", rb.Prefix)
+		case len(rb.LeaseID) != 0:
+			err = client.Sys().Revoke(rb.LeaseID)
+			payload.Message = fmt.Sprintf("Success! Revoked lease %s", rb.LeaseID)
+		default:
+			fmt.Println("empty leaseId and prefix")
+			http.Error(w, "one of leaseId or prefix is required", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			fmt.Println("Error revoking:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	for i := range payload.Leases {
+		if time.Duration(payload.Leases[i].TTL)*time.Second <= expiringWithin {
+			payload.Leases[i].ExpiringSoon = true
+			payload.Expiring++
+		}
+	}
+	sort.SliceStable(payload.Leases, func(i, j int) bool {
+		return payload.Leases[i].TTL < payload.Leases[j].TTL
+	})
+
+	resBody := ""
+	if r.Header.Get("Content-Type") == "text/plain" {
+		out := []string{}
+		if len(payload.Message) != 0 {
+			out = append(out, payload.Message)
+		}
+		if payload.Leases != nil {
+			if len(out) != 0 {
+				out = append(out, "")
+			}
+			out = append(out, formatLeases(payload.Leases, expiringWithin)...)
+			if payload.Truncated {
+				out = append(out, fmt.Sprintf("Only the first %d leases are shown", maxLeases))
+			}
+		}
+
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "    "
+		columnConf.NoTrim = false
+		resBody = columnize.Format(out, columnConf)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+// listLeases walks sys/leases/lookup under prefix and returns up to max
+// lease ids, and whether there were more.
+func listLeases(client *vault.Client, prefix string, max int) ([]string, bool, error) {
+	secret, err := client.Logical().List("sys/leases/lookup/" + prefix)
+	if err != nil {
+		return nil, false, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, false, nil
+	}
+
+	keys, _ := secret.Data["keys"].([]interface{})
+	ids := []string{}
+	for _, k := range keys {
+		// truncated only if there are keys left once max is reached
+		if len(ids) >= max {
+			return ids, true, nil
+		}
+		key, _ := k.(string)
+		if !strings.HasSuffix(key, "/") {
+			ids = append(ids, prefix+key)
+		} else {
+			children, truncated, err := listLeases(client, prefix+key, max-len(ids))
+			if err != nil {
+				return nil, false, err
+			}
+			ids = append(ids, children...)
+			if truncated {
+				return ids, true, nil
+			}
+		}
+	}
+	return ids, false, nil
+}
+
+func lookup(client *vault.Client, id string) (Lease, error) {
+	secret, err := client.Logical().Write("sys/leases/lookup", map[string]interface{}{
+		"lease_id": id,
+	})
+	if err != nil {
+		return Lease{}, err
+	}
+	if secret == nil || secret.Data == nil {
+		return Lease{}, fmt.Errorf("lease %s not found", id)
+	}
+
+	lease := Lease{ID: id}
+	lease.IssueTime, _ = secret.Data["issue_time"].(string)
+	lease.ExpireTime, _ = secret.Data["expire_time"].(string)
+	lease.LastRenewal, _ = secret.Data["last_renewal"].(string)
+	lease.Renewable, _ = secret.Data["renewable"].(bool)
+	if ttl, ok := secret.Data["ttl"].(json.Number); ok {
+		seconds, _ := ttl.Int64()
+		lease.TTL = int(seconds)
+	}
+	return lease, nil
+}
+
+// formatLeases lists the leases expiring within the given duration first,
+// they are the ones somebody needs to look at.
+func formatLeases(leases []Lease, expiringWithin time.Duration) []string {
+	out := []string{}
+	expiring := 0
+	for _, l := range leases {
+		if l.ExpiringSoon {
+			expiring++
+		}
+	}
+
+	if expiring > 0 {
+		out = append(out, fmt.Sprintf("Expiring within %s\t\t\t", expiringWithin))
+		out = append(out, "Lease ID\tTTL\tExpire Time\tRenewable")
+		for _, l := range leases {
+			if l.ExpiringSoon {
+				out = append(out, fmt.Sprintf("%s\t%s\t%s\t%t", l.ID, formatTTL(l.TTL), formatTime(l.ExpireTime), l.Renewable))
+			}
+		}
+		out = append(out, "")
+	}
+
+	out = append(out, "Lease ID\tTTL\tIssue Time\tExpire Time\tLast Renewal\tRenewable")
+	for _, l := range leases {
+		out = append(out, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%t",
+			l.ID, formatTTL(l.TTL), formatTime(l.IssueTime), formatTime(l.ExpireTime), formatTime(l.LastRenewal), l.Renewable))
+	}
+	out = append(out, "")
+	out = append(out, fmt.Sprintf("Leases\t%d", len(leases)))
+	out = append(out, fmt.Sprintf("Expiring within %s\t%d", expiringWithin, expiring))
+	return out
+}
+
+func formatTTL(ttl int) string {
+	return (time.Duration(ttl) * time.Second).String()
+}
+
+func formatTime(t string) string {
+	if len(t) == 0 {
+		return "-"
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, t)
+	if err != nil {
+		return t
+	}
+	return parsed.UTC().Format(time.RFC3339)
+}
+
+// parseIncrement accepts either a number of seconds or a duration string.
+func parseIncrement(increment string) (int, error) {
+	if len(increment) == 0 {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(increment); err == nil {
+		return seconds, nil
+	}
+	d, err := time.ParseDuration(increment)
+	if err != nil {
+		return 0, fmt.Errorf("invalid increment %q", increment)
+	}
+	return int(d.Seconds()), nil
+}
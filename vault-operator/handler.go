@@ -0,0 +1,11 @@
+package function
+
+import (
+	"net/http"
+
+	vaultoperator "github.com/efbar/more-serverless/vault-operator/vaultoperator"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	vaultoperator.Serve(w, r)
+}
@@ -0,0 +1,212 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	network "github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/efbar/more-serverless/vault-operator/vaultoperator"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const vaultServerPort = "1234"
+
+func TestFunc(t *testing.T) {
+
+	tt := []struct {
+		contentType string
+		action      string
+		key         string
+		confirm     string
+		statusCode  int
+	}{
+		{
+			contentType: "text/plain",
+			action:      "seal-status",
+			statusCode:  http.StatusOK,
+		},
+		{
+			contentType: "application/json",
+			action:      "generate-root-status",
+			statusCode:  http.StatusOK,
+		},
+		{
+			contentType: "text/plain",
+			action:      "rekey-status",
+			statusCode:  http.StatusOK,
+		},
+		{
+			contentType: "application/json",
+			action:      "unseal",
+			key:         "aGVsbG8=",
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			contentType: "text/plain",
+			action:      "seal",
+			confirm:     "unseal",
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			contentType: "text/plain",
+			action:      "seal",
+			confirm:     "seal",
+			statusCode:  http.StatusOK,
+		},
+		{
+			contentType: "application/json",
+			action:      "seal-status",
+			statusCode:  http.StatusOK,
+		},
+	}
+
+	cli, err := client.NewClientWithOpts()
+	if err != nil {
+		fmt.Printf("Can't instantiate docker client: %s", err.Error())
+	}
+
+	resp, err := startContainerService(cli, "vault")
+	if err != nil {
+		t.Logf("Can't create container: %s", err.Error())
+	}
+	t.Log(resp.ID)
+	defer removeContainerService(cli, resp.ID)
+
+	for _, tr := range tt {
+		t.Log(tr.action)
+
+		jsonStruct := map[string]interface{}{
+			"endpoint": "http://127.0.0.1:" + vaultServerPort,
+			"token":    "root",
+			"action":   tr.action,
+		}
+		if len(tr.key) != 0 {
+			jsonStruct["key"] = tr.key
+		}
+		if len(tr.confirm) != 0 {
+			jsonStruct["confirm"] = tr.confirm
+		}
+
+		jsonBody, _ := json.Marshal(jsonStruct)
+		req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+		req.Header.Set("Content-Type", tr.contentType)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(vaultoperator.Serve)
+
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tr.statusCode {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, tr.statusCode)
+		}
+
+		if tr.action == "seal-status" && tr.contentType == "application/json" {
+			res := vaultoperator.Response{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("can't parse response: %s", err)
+			}
+			if res.Payload.Seal == nil || !res.Payload.Seal.Sealed {
+				t.Errorf("vault should be sealed")
+			}
+		}
+
+		fmt.Printf("response body: \n%s\n", rr.Body)
+	}
+
+}
+
+func startContainerService(cli *client.Client, containerName string) (*container.ContainerCreateCreatedBody, error) {
+	// context
+	ctx := context.Background()
+
+	// config
+	config := &container.Config{
+		Image: containerName,
+		ExposedPorts: nat.PortSet{
+			"8200/tcp": struct{}{},
+		},
+		Cmd: []string{"server", "-dev", fmt.Sprintf("-dev-root-token-id=%s", "root"), "-dev-listen-address=0.0.0.0:8200"},
+	}
+
+	hostConfig := &container.HostConfig{
+		Binds: []string{
+			"/var/run/docker.sock:/var/run/docker.sock",
+		},
+		PortBindings: nat.PortMap{
+			"8200/tcp": []nat.PortBinding{
+				{
+					HostIP:   "127.0.0.1",
+					HostPort: vaultServerPort,
+				},
+			},
+		},
+		RestartPolicy: container.RestartPolicy{
+			Name: "always",
+		},
+		LogConfig: container.LogConfig{
+			Type:   "json-file",
+			Config: map[string]string{},
+		},
+	}
+
+	networkConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{},
+	}
+	gatewayConfig := &network.EndpointSettings{
+		Gateway: "gatewayname",
+	}
+	networkConfig.EndpointsConfig["bridge"] = gatewayConfig
+
+	resp, err := cli.ContainerCreate(
+		ctx,
+		config,
+		hostConfig,
+		networkConfig,
+		&v1.Platform{
+			Architecture: "amd64",
+			OS:           "linux",
+		},
+		containerName,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func removeContainerService(cli *client.Client, containerName string) {
+	ctx := context.Background()
+
+	err := cli.ContainerStop(ctx, containerName, nil)
+	if err != nil {
+		fmt.Printf("Can't stop container: %s", err.Error())
+		return
+	}
+
+	removeOptions := types.ContainerRemoveOptions{
+		RemoveVolumes: true,
+		Force:         true,
+	}
+	err = cli.ContainerRemove(ctx, containerName, removeOptions)
+	if err != nil {
+		fmt.Printf("Can't remove container: %s", err.Error())
+		return
+	}
+
+}
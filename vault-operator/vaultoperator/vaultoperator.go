@@ -0,0 +1,238 @@
+package vaultoperator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/ryanuber/columnize"
+)
+
+type RequestBody struct {
+	Token    string `json:"token,omitempty"`
+	Endpoint string `json:"endpoint"`
+	Action   string `json:"action"`
+	Key      string `json:"key,omitempty"`
+	Recovery bool   `json:"recovery,omitempty"`
+	Confirm  string `json:"confirm,omitempty"`
+}
+
+type Payload struct {
+	Seal         *vault.SealStatusResponse         `json:"seal_status,omitempty"`
+	GenerateRoot *vault.GenerateRootStatusResponse `json:"generate_root_status,omitempty"`
+	Rekey        *vault.RekeyStatusResponse        `json:"rekey_status,omitempty"`
+	Message      string                            `json:"message,omitempty"`
+}
+
+type Response struct {
+	Payload Payload             `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+// actions changing the state of the node, they must be repeated in the
+// confirm field of the request
+var guarded = map[string]bool{
+	"unseal":       true,
+	"unseal-reset": true,
+	"seal":         true,
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	if guarded[rb.Action] && rb.Confirm != rb.Action {
+		fmt.Printf("%s not confirmed\n", rb.Action)
+		http.Error(w, fmt.Sprintf("%s must be confirmed with \"confirm\": %q", rb.Action, rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	conf := vault.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rb.Token != "" {
+		client.SetToken(rb.Token)
+	}
+
+	payload := Payload{}
+	switch rb.Action {
+	case "seal-status", "":
+		payload.Seal, err = client.Sys().SealStatus()
+
+	case "unseal":
+		if len(rb.Key) == 0 {
+			fmt.Println("empty unseal key")
+			http.Error(w, "empty unseal key", http.StatusBadRequest)
+			return
+		}
+		// the key share is never logged, only the resulting progress
+		payload.Seal, err = client.Sys().Unseal(rb.Key)
+		if err == nil && !payload.Seal.Sealed {
+			payload.Message = "Success! Vault is unsealed"
+		}
+
+	case "unseal-reset":
+		payload.Seal, err = client.Sys().ResetUnsealProcess()
+		if err == nil {
+			payload.Message = "Success! Unseal progress reset"
+		}
+
+	case "seal":
+		err = client.Sys().Seal()
+		if err == nil {
+			payload.Message = "Success! Vault is sealed"
+			payload.Seal, err = client.Sys().SealStatus()
+		}
+
+	case "generate-root-status":
+		payload.GenerateRoot, err = client.Sys().GenerateRootStatus()
+
+	case "rekey-status":
+		if rb.Recovery {
+			payload.Rekey, err = client.Sys().RekeyRecoveryKeyStatus()
+		} else {
+			payload.Rekey, err = client.Sys().RekeyStatus()
+		}
+
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error on %s: %s\n", rb.Action, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if guarded[rb.Action] {
+		fmt.Printf("%s on %s: %s\n", rb.Action, rb.Endpoint, progress(&payload))
+	}
+
+	resBody := ""
+	if r.Header.Get("Content-Type") == "text/plain" {
+		out := []string{}
+		if len(payload.Message) != 0 {
+			out = append(out, payload.Message, "")
+		}
+		out = append(out, "Key\tValue", "---\t-----")
+		out = append(out, formatPayload(&payload)...)
+
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "    "
+		columnConf.NoTrim = false
+		resBody = columnize.Format(out, columnConf)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+func formatPayload(payload *Payload) []string {
+	out := []string{}
+
+	if status := payload.Seal; status != nil {
+		sealPrefix := ""
+		if status.RecoverySeal {
+			sealPrefix = "Recovery "
+		}
+		out = append(out, fmt.Sprintf("%sSeal Type\t%s", sealPrefix, status.Type))
+		out = append(out, fmt.Sprintf("Initialized\t%t", status.Initialized))
+		out = append(out, fmt.Sprintf("Sealed\t%t", status.Sealed))
+		out = append(out, fmt.Sprintf("Total Shares\t%d", status.N))
+		out = append(out, fmt.Sprintf("Threshold\t%d", status.T))
+		if status.Sealed {
+			out = append(out, fmt.Sprintf("Unseal Progress\t%d/%d", status.Progress, status.T))
+			out = append(out, fmt.Sprintf("Unseal Nonce\t%s", orNone(status.Nonce)))
+		}
+		out = append(out, fmt.Sprintf("Version\t%s", status.Version))
+	}
+
+	if status := payload.GenerateRoot; status != nil {
+		out = append(out, fmt.Sprintf("Nonce\t%s", orNone(status.Nonce)))
+		out = append(out, fmt.Sprintf("Started\t%t", status.Started))
+		out = append(out, fmt.Sprintf("Progress\t%d/%d", status.Progress, status.Required))
+		out = append(out, fmt.Sprintf("Complete\t%t", status.Complete))
+		if len(status.PGPFingerprint) != 0 {
+			out = append(out, fmt.Sprintf("PGP Fingerprint\t%s", status.PGPFingerprint))
+		}
+		out = append(out, fmt.Sprintf("OTP Length\t%d", status.OTPLength))
+	}
+
+	if status := payload.Rekey; status != nil {
+		out = append(out, fmt.Sprintf("Nonce\t%s", orNone(status.Nonce)))
+		out = append(out, fmt.Sprintf("Started\t%t", status.Started))
+		out = append(out, fmt.Sprintf("Rekey Progress\t%d/%d", status.Progress, status.Required))
+		out = append(out, fmt.Sprintf("New Shares\t%d", status.N))
+		out = append(out, fmt.Sprintf("New Threshold\t%d", status.T))
+		out = append(out, fmt.Sprintf("Verification Required\t%t", status.VerificationRequired))
+		if len(status.PGPFingerprints) != 0 {
+			out = append(out, fmt.Sprintf("PGP Fingerprints\t%s", strings.Join(status.PGPFingerprints, ", ")))
+			out = append(out, fmt.Sprintf("Backup\t%t", status.Backup))
+		}
+	}
+
+	return out
+}
+
+func progress(payload *Payload) string {
+	if payload.Seal == nil {
+		return payload.Message
+	}
+	if !payload.Seal.Sealed {
+		return "unsealed"
+	}
+	return fmt.Sprintf("sealed, unseal progress %d/%d", payload.Seal.Progress, payload.Seal.T)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
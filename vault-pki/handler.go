@@ -0,0 +1,11 @@
+package function
+
+import (
+	"net/http"
+
+	vaultpki "github.com/efbar/more-serverless/vault-pki/vaultpki"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	vaultpki.Serve(w, r)
+}
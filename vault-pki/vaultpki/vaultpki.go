@@ -0,0 +1,412 @@
+package vaultpki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	storage "cloud.google.com/go/storage"
+	vaultwrap "github.com/efbar/more-serverless/vault-wrap/vaultwrap"
+	vault "github.com/hashicorp/vault/api"
+	"github.com/ryanuber/columnize"
+	option "google.golang.org/api/option"
+)
+
+type RequestBody struct {
+	Token       string   `json:"token"`
+	Endpoint    string   `json:"endpoint"`
+	Action      string   `json:"action"`
+	Mount       string   `json:"mount,omitempty"`
+	Role        string   `json:"role,omitempty"`
+	CommonName  string   `json:"commonName,omitempty"`
+	AltNames    []string `json:"altNames,omitempty"`
+	IPSans      []string `json:"ipSans,omitempty"`
+	TTL         string   `json:"ttl,omitempty"`
+	Serial      string   `json:"serial,omitempty"`
+	KVPath      string   `json:"kvPath,omitempty"`
+	Bucket      string   `json:"bucket,omitempty"`
+	Object      string   `json:"object,omitempty"`
+	JsonKeyPath string   `json:"jsonKeyPath,omitempty"`
+	WrapTTL     string   `json:"wrapTtl,omitempty"`
+}
+
+type Bundle struct {
+	SerialNumber   string   `json:"serial_number"`
+	Certificate    string   `json:"certificate"`
+	IssuingCA      string   `json:"issuing_ca"`
+	CAChain        []string `json:"ca_chain,omitempty"`
+	PrivateKey     string   `json:"private_key,omitempty"`
+	PrivateKeyType string   `json:"private_key_type,omitempty"`
+	Expiration     string   `json:"expiration,omitempty"`
+}
+
+type Payload struct {
+	Bundle         *Bundle  `json:"bundle,omitempty"`
+	Serials        []string `json:"serials,omitempty"`
+	RevocationTime string   `json:"revocation_time,omitempty"`
+	KVPath         string   `json:"kvPath,omitempty"`
+	GsUri          string   `json:"gsUri,omitempty"`
+}
+
+type Response struct {
+	Payload Payload             `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	conf := vault.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rb.Token != "" {
+		client.SetToken(rb.Token)
+	}
+
+	mount := strings.Trim(rb.Mount, "/")
+	if mount == "" {
+		mount = "pki"
+	}
+
+	var payload Payload
+	switch rb.Action {
+	case "issue", "":
+		if len(rb.Role) == 0 || len(rb.CommonName) == 0 {
+			fmt.Println("empty role or common name")
+			http.Error(w, "role and commonName are mandatory", http.StatusBadRequest)
+			return
+		}
+		bundle, err := issue(client, mount, &rb)
+		if err != nil {
+			fmt.Printf("Error issuing certificate from %s/issue/%s: %s\n", mount, rb.Role, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload.Bundle = bundle
+
+		if len(rb.KVPath) != 0 {
+			if err := writeKV(client, rb.KVPath, bundle); err != nil {
+				fmt.Printf("Error writing bundle to %s: %s\n", rb.KVPath, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			payload.KVPath = rb.KVPath
+		}
+
+		if len(rb.Bucket) != 0 {
+			gsUri, err := writeObject(&rb, bundle)
+			if err != nil {
+				fmt.Printf("Error writing bundle to bucket %s: %s\n", rb.Bucket, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			payload.GsUri = gsUri
+		}
+
+	case "read":
+		if len(rb.Serial) == 0 {
+			fmt.Println("empty serial")
+			http.Error(w, "empty serial", http.StatusBadRequest)
+			return
+		}
+		secret, err := client.Logical().Read(fmt.Sprintf("%s/cert/%s", mount, rb.Serial))
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if secret == nil {
+			http.Error(w, fmt.Sprintf("certificate %s not found", rb.Serial), http.StatusNotFound)
+			return
+		}
+		payload.Bundle = &Bundle{
+			SerialNumber: rb.Serial,
+			Certificate:  stringValue(secret.Data["certificate"]),
+		}
+		payload.RevocationTime = formatTime(secret.Data["revocation_time"])
+
+	case "list":
+		secret, err := client.Logical().List(mount + "/certs")
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload.Serials = []string{}
+		if secret != nil {
+			if keys, ok := secret.Data["keys"].([]interface{}); ok {
+				for _, k := range keys {
+					payload.Serials = append(payload.Serials, stringValue(k))
+				}
+			}
+		}
+		sort.Strings(payload.Serials)
+
+	case "revoke":
+		if len(rb.Serial) == 0 {
+			fmt.Println("empty serial")
+			http.Error(w, "empty serial", http.StatusBadRequest)
+			return
+		}
+		secret, err := client.Logical().Write(mount+"/revoke", map[string]interface{}{
+			"serial_number": rb.Serial,
+		})
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload.Bundle = &Bundle{SerialNumber: rb.Serial}
+		if secret != nil {
+			payload.RevocationTime = formatTime(secret.Data["revocation_time"])
+		}
+
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.WrapTTL) != 0 {
+		vaultwrap.Respond(w, r, client, rb.WrapTTL, payload)
+		return
+	}
+
+	resBody := ""
+	if r.Header.Get("Content-Type") == "text/plain" {
+		if payload.Bundle != nil && len(payload.Bundle.Certificate) != 0 {
+			resBody = formatBundle(&payload)
+		} else {
+			out := []string{}
+			if payload.Serials != nil {
+				out = append(out, "Serial")
+				out = append(out, "------")
+				out = append(out, payload.Serials...)
+			} else {
+				out = append(out, "Key\tValue")
+				out = append(out, "---\t-----")
+				out = append(out, fmt.Sprintf("serial_number\t%s", payload.Bundle.SerialNumber))
+				out = append(out, fmt.Sprintf("revocation_time\t%s", payload.RevocationTime))
+			}
+
+			columnConf := columnize.DefaultConfig()
+			columnConf.Delim = "\t"
+			columnConf.Glue = "    "
+			columnConf.NoTrim = false
+			resBody = columnize.Format(out, columnConf)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+func issue(client *vault.Client, mount string, rb *RequestBody) (*Bundle, error) {
+	data := map[string]interface{}{
+		"common_name": rb.CommonName,
+	}
+	if len(rb.AltNames) != 0 {
+		data["alt_names"] = strings.Join(rb.AltNames, ",")
+	}
+	if len(rb.IPSans) != 0 {
+		data["ip_sans"] = strings.Join(rb.IPSans, ",")
+	}
+	if len(rb.TTL) != 0 {
+		data["ttl"] = rb.TTL
+	}
+
+	secret, err := client.Logical().Write(fmt.Sprintf("%s/issue/%s", mount, rb.Role), data)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("no certificate returned")
+	}
+
+	bundle := &Bundle{
+		SerialNumber:   stringValue(secret.Data["serial_number"]),
+		Certificate:    stringValue(secret.Data["certificate"]),
+		IssuingCA:      stringValue(secret.Data["issuing_ca"]),
+		PrivateKey:     stringValue(secret.Data["private_key"]),
+		PrivateKeyType: stringValue(secret.Data["private_key_type"]),
+		Expiration:     formatTime(secret.Data["expiration"]),
+	}
+	if chain, ok := secret.Data["ca_chain"].([]interface{}); ok {
+		for _, c := range chain {
+			bundle.CAChain = append(bundle.CAChain, stringValue(c))
+		}
+	}
+
+	return bundle, nil
+}
+
+// writeKV stores the bundle at a KV path, which needs the data subpath for
+// KV version 2 mounts, like vault-kv-put does.
+func writeKV(client *vault.Client, path string, bundle *Bundle) error {
+	data := map[string]interface{}{
+		"serial_number": bundle.SerialNumber,
+		"certificate":   bundle.Certificate,
+		"issuing_ca":    bundle.IssuingCA,
+		"ca_chain":      strings.Join(bundle.CAChain, "\n"),
+		"private_key":   bundle.PrivateKey,
+		"expiration":    bundle.Expiration,
+	}
+
+	queryData := data
+	if strings.Contains(path, "/data/") {
+		queryData = map[string]interface{}{
+			"data":    data,
+			"options": map[string]interface{}{},
+		}
+	}
+
+	_, err := client.Logical().Write(path, queryData)
+	return err
+}
+
+// writeObject stores the PEM bundle, certificate first, then the chain and
+// the private key, in a GCS object.
+func writeObject(rb *RequestBody, bundle *Bundle) (string, error) {
+	object := rb.Object
+	if len(object) == 0 {
+		object = fmt.Sprintf("%s/%s.pem", rb.CommonName, bundle.SerialNumber)
+	}
+
+	serviceAccountPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if len(rb.JsonKeyPath) != 0 {
+		serviceAccountPath = rb.JsonKeyPath
+		fmt.Printf("using jsonKeyPath value %s\n", rb.JsonKeyPath)
+	}
+
+	var storageClient *storage.Client
+	var err error
+	ctx := context.Background()
+
+	if _, statErr := os.Stat(serviceAccountPath); len(serviceAccountPath) != 0 && statErr == nil {
+		storageClient, err = storage.NewClient(ctx, option.WithCredentialsFile(serviceAccountPath))
+	} else {
+		fmt.Println("jsonkey empty, not using creds option")
+		storageClient, err = storage.NewClient(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer storageClient.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	pem := []string{bundle.Certificate}
+	if len(bundle.CAChain) != 0 {
+		pem = append(pem, bundle.CAChain...)
+	} else if len(bundle.IssuingCA) != 0 {
+		pem = append(pem, bundle.IssuingCA)
+	}
+	pem = append(pem, bundle.PrivateKey)
+
+	wc := storageClient.Bucket(rb.Bucket).Object(object).NewWriter(ctx)
+	wc.ContentType = "application/x-pem-file"
+	if _, err := wc.Write([]byte(strings.Join(pem, "\n") + "\n")); err != nil {
+		wc.Close()
+		return "", err
+	}
+	if err := wc.Close(); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("gs://%s/%s", rb.Bucket, object), nil
+}
+
+func formatBundle(payload *Payload) string {
+	b := payload.Bundle
+	out := []string{
+		fmt.Sprintf("serial_number:    %s", b.SerialNumber),
+	}
+	if len(b.Expiration) != 0 {
+		out = append(out, fmt.Sprintf("expiration:       %s", b.Expiration))
+	}
+	if len(payload.RevocationTime) != 0 {
+		out = append(out, fmt.Sprintf("revocation_time:  %s", payload.RevocationTime))
+	}
+	if len(payload.KVPath) != 0 {
+		out = append(out, fmt.Sprintf("kv_path:          %s", payload.KVPath))
+	}
+	if len(payload.GsUri) != 0 {
+		out = append(out, fmt.Sprintf("gs_uri:           %s", payload.GsUri))
+	}
+	out = append(out, "", b.Certificate)
+	if len(b.CAChain) != 0 {
+		out = append(out, b.CAChain...)
+	} else if len(b.IssuingCA) != 0 {
+		out = append(out, b.IssuingCA)
+	}
+	if len(b.PrivateKey) != 0 {
+		out = append(out, b.PrivateKey)
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+func formatTime(v interface{}) string {
+	n, ok := v.(json.Number)
+	if !ok {
+		return ""
+	}
+	ts, err := n.Int64()
+	if err != nil || ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
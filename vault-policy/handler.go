@@ -0,0 +1,11 @@
+package function
+
+import (
+	"net/http"
+
+	vaultpolicy "github.com/efbar/more-serverless/vault-policy/vaultpolicy"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	vaultpolicy.Serve(w, r)
+}
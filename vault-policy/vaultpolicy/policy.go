@@ -0,0 +1,206 @@
+package vaultpolicy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+var capabilities = map[string]bool{
+	"create": true,
+	"read":   true,
+	"update": true,
+	"patch":  true,
+	"delete": true,
+	"list":   true,
+	"sudo":   true,
+	"deny":   true,
+}
+
+// legacy values of the policy key, superseded by capabilities
+var legacyPolicies = map[string]bool{
+	"deny":  true,
+	"read":  true,
+	"write": true,
+	"sudo":  true,
+}
+
+var pathKeys = map[string]bool{
+	"capabilities":        true,
+	"policy":              true,
+	"allowed_parameters":  true,
+	"denied_parameters":   true,
+	"required_parameters": true,
+	"min_wrapping_ttl":    true,
+	"max_wrapping_ttl":    true,
+	"control_group":       true,
+	"mfa_methods":         true,
+}
+
+// validate parses the policy and checks it the way Vault would before
+// accepting it: only path blocks, only known keys, only known capabilities.
+func validate(policy string) error {
+	if len(strings.TrimSpace(policy)) == 0 {
+		return fmt.Errorf("empty policy")
+	}
+
+	root, err := hcl.ParseString(policy)
+	if err != nil {
+		return err
+	}
+	list, ok := root.Node.(*ast.ObjectList)
+	if !ok {
+		return fmt.Errorf("policy doesn't contain a root object")
+	}
+
+	paths := 0
+	for _, item := range list.Items {
+		key := keyValue(item.Keys[0])
+		switch key {
+		case "name":
+			continue
+		case "path":
+		default:
+			return fmt.Errorf("line %d: invalid key %q", item.Pos().Line, key)
+		}
+
+		if len(item.Keys) != 2 {
+			return fmt.Errorf("line %d: path block needs a single path, like path \"secret/*\" { ... }", item.Pos().Line)
+		}
+		if err := validatePath(keyValue(item.Keys[1]), item); err != nil {
+			return err
+		}
+		paths++
+	}
+
+	if paths == 0 {
+		return fmt.Errorf("no path blocks")
+	}
+	return nil
+}
+
+func validatePath(path string, item *ast.ObjectItem) error {
+	object, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		return fmt.Errorf("line %d: path %q is not an object", item.Pos().Line, path)
+	}
+
+	defined := false
+	for _, field := range object.List.Items {
+		key := keyValue(field.Keys[0])
+		if !pathKeys[key] {
+			return fmt.Errorf("line %d: path %q: invalid key %q", field.Pos().Line, path, key)
+		}
+
+		switch key {
+		case "capabilities":
+			values, ok := field.Val.(*ast.ListType)
+			if !ok {
+				return fmt.Errorf("line %d: path %q: capabilities must be a list", field.Pos().Line, path)
+			}
+			for _, v := range values.List {
+				capability := literalValue(v)
+				if !capabilities[capability] {
+					return fmt.Errorf("line %d: path %q: invalid capability %q", v.Pos().Line, path, capability)
+				}
+			}
+			defined = true
+		case "policy":
+			policy := literalValue(field.Val)
+			if !legacyPolicies[policy] {
+				return fmt.Errorf("line %d: path %q: invalid policy %q", field.Pos().Line, path, policy)
+			}
+			defined = true
+		}
+	}
+
+	if !defined {
+		return fmt.Errorf("line %d: path %q has no capabilities", item.Pos().Line, path)
+	}
+	return nil
+}
+
+func keyValue(key *ast.ObjectKey) string {
+	if s, ok := key.Token.Value().(string); ok {
+		return s
+	}
+	return key.Token.Text
+}
+
+func literalValue(node ast.Node) string {
+	literal, ok := node.(*ast.LiteralType)
+	if !ok {
+		return ""
+	}
+	if s, ok := literal.Token.Value().(string); ok {
+		return s
+	}
+	return literal.Token.Text
+}
+
+// diff compares two policies line by line and returns every line of the
+// result prefixed with "+ ", "- " or "  ", like a unified diff with full
+// context. Policies are short, so the plain LCS table is enough.
+func diff(current, proposed string) []string {
+	a := splitLines(current)
+	b := splitLines(proposed)
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	out := []string{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "- "+a[i])
+			i++
+		default:
+			out = append(out, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		out = append(out, "+ "+b[j])
+	}
+	return out
+}
+
+func changed(diff []string) bool {
+	for _, line := range diff {
+		if !strings.HasPrefix(line, "  ") {
+			return true
+		}
+	}
+	return false
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if len(s) == 0 {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,226 @@
+package vaultpolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	message "github.com/efbar/more-serverless/slack-message/slackmessage"
+	vaultwrap "github.com/efbar/more-serverless/vault-wrap/vaultwrap"
+	vault "github.com/hashicorp/vault/api"
+)
+
+type RequestBody struct {
+	Token        string `json:"token"`
+	Endpoint     string `json:"endpoint"`
+	Action       string `json:"action"`
+	Name         string `json:"name,omitempty"`
+	Policy       string `json:"policy,omitempty"`
+	DryRun       bool   `json:"dryRun,omitempty"`
+	WrapTTL      string `json:"wrapTtl,omitempty"`
+	SlackToken   string `json:"slackToken,omitempty"`
+	SlackChannel string `json:"slackChannel,omitempty"`
+	SlackEmoji   string `json:"slackEmoji,omitempty"`
+}
+
+type Payload struct {
+	Policies []string `json:"policies,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Policy   string   `json:"policy,omitempty"`
+	Changed  bool     `json:"changed"`
+	Diff     []string `json:"diff,omitempty"`
+	Message  string   `json:"message,omitempty"`
+}
+
+type Response struct {
+	Payload Payload             `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	if rb.Action != "list" && rb.Action != "" && len(rb.Name) == 0 {
+		fmt.Println("empty policy name")
+		http.Error(w, "empty policy name", http.StatusBadRequest)
+		return
+	}
+
+	conf := vault.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rb.Token != "" {
+		client.SetToken(rb.Token)
+	}
+
+	payload := Payload{Name: rb.Name}
+	switch rb.Action {
+	case "list", "":
+		policies, err := client.Sys().ListPolicies()
+		if err != nil {
+			fmt.Println("Error listing policies:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sort.Strings(policies)
+		payload.Policies = policies
+
+	case "read":
+		policy, err := client.Sys().GetPolicy(rb.Name)
+		if err != nil {
+			fmt.Printf("Error reading policy %s: %s\n", rb.Name, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(policy) == 0 {
+			fmt.Println("no policy named", rb.Name)
+			http.Error(w, fmt.Sprintf("no policy named %s", rb.Name), http.StatusNotFound)
+			return
+		}
+		payload.Policy = policy
+
+	case "write", "diff":
+		if err := validate(rb.Policy); err != nil {
+			fmt.Printf("Invalid policy %s: %s\n", rb.Name, err)
+			http.Error(w, fmt.Sprintf("invalid policy: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		current, err := client.Sys().GetPolicy(rb.Name)
+		if err != nil {
+			fmt.Printf("Error reading policy %s: %s\n", rb.Name, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		payload.Policy = rb.Policy
+		payload.Diff = diff(current, rb.Policy)
+		payload.Changed = changed(payload.Diff)
+
+		switch {
+		case !payload.Changed:
+			payload.Message = fmt.Sprintf("No changes to policy %s", rb.Name)
+		case rb.Action == "diff" || rb.DryRun:
+			payload.Message = fmt.Sprintf("Policy %s is valid, not written", rb.Name)
+		default:
+			if err := client.Sys().PutPolicy(rb.Name, rb.Policy); err != nil {
+				fmt.Printf("Error writing policy %s: %s\n", rb.Name, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			payload.Message = fmt.Sprintf("Success! Uploaded policy: %s", rb.Name)
+		}
+
+	case "delete":
+		if err := client.Sys().DeletePolicy(rb.Name); err != nil {
+			fmt.Printf("Error deleting policy %s: %s\n", rb.Name, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload.Changed = true
+		payload.Message = fmt.Sprintf("Success! Deleted policy: %s", rb.Name)
+
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.WrapTTL) != 0 {
+		vaultwrap.Respond(w, r, client, rb.WrapTTL, payload)
+		return
+	}
+
+	resBody := formatPayload(&payload)
+
+	if len(rb.SlackToken) > 0 && len(rb.SlackChannel) > 0 && (rb.Action == "write" || rb.Action == "diff" || rb.Action == "delete") {
+		slackNotification(&rb, resBody)
+	}
+
+	if r.Header.Get("Content-Type") == "text/plain" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+// formatPayload renders the payload as text. Policies and diffs are printed
+// as they are, columnize would eat their indentation.
+func formatPayload(payload *Payload) string {
+	out := []string{}
+	switch {
+	case payload.Policies != nil:
+		out = append(out, payload.Policies...)
+	case payload.Diff != nil:
+		if payload.Changed {
+			out = append(out, fmt.Sprintf("--- %s (current)", payload.Name))
+			out = append(out, fmt.Sprintf("+++ %s (proposed)", payload.Name))
+			out = append(out, payload.Diff...)
+			out = append(out, "")
+		}
+		out = append(out, payload.Message)
+	case len(payload.Message) != 0:
+		out = append(out, payload.Message)
+	default:
+		out = append(out, strings.TrimRight(payload.Policy, "\n"))
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+func slackNotification(rb *RequestBody, resBody string) {
+	slackToken := rb.SlackToken
+	slackChannelID := rb.SlackChannel
+	slackEmoji := rb.SlackEmoji
+	slackMessage := "Vault policy " + rb.Name + " " + slackEmoji + "\n```" + resBody + "```"
+
+	sent, err := message.Send(slackToken, slackMessage, slackChannelID)
+	if err != nil {
+		fmt.Printf("slack error: %s\n", err)
+	}
+	fmt.Println(sent)
+}
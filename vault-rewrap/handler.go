@@ -0,0 +1,11 @@
+package function
+
+import (
+	"net/http"
+
+	vaultrewrap "github.com/efbar/more-serverless/vault-rewrap/vaultrewrap"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	vaultrewrap.Serve(w, r)
+}
@@ -0,0 +1,27 @@
+module github.com/efbar/more-serverless/vault-rewrap/vaultrewrap
+
+go 1.16
+
+require (
+	cloud.google.com/go/storage v1.15.0
+	github.com/Microsoft/go-winio v0.4.16 // indirect
+	github.com/containerd/containerd v1.4.4 // indirect
+	github.com/docker/distribution v2.7.1+incompatible // indirect
+	github.com/docker/docker v20.10.5+incompatible
+	github.com/docker/go-connections v0.4.0
+	github.com/docker/go-units v0.4.0 // indirect
+	github.com/efbar/more-serverless/vault-kv/vaultkv v0.0.0-00010101000000-000000000000
+	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/gorilla/mux v1.8.0 // indirect
+	github.com/hashicorp/vault/api v1.1.0
+	github.com/moby/term v0.0.0-20201216013528-df9cb8a40635 // indirect
+	github.com/morikuni/aec v1.0.0 // indirect
+	github.com/opencontainers/go-digest v1.0.0 // indirect
+	github.com/opencontainers/image-spec v1.0.1
+	github.com/ryanuber/columnize v2.1.2+incompatible
+	github.com/sirupsen/logrus v1.8.1 // indirect
+	google.golang.org/api v0.47.0
+	gotest.tools/v3 v3.0.3 // indirect
+)
+
+replace github.com/efbar/more-serverless/vault-kv/vaultkv => ../../vault-kv/vaultkv
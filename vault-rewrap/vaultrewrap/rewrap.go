@@ -0,0 +1,174 @@
+package vaultrewrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// ciphertextRe matches transit ciphertexts anywhere in a string, the key
+// version being the first group.
+var ciphertextRe = regexp.MustCompile(`vault:v([0-9]+):[A-Za-z0-9+/]+=*`)
+
+// otherKeyErrors are the rewrap errors of a ciphertext that the key can't
+// decrypt: it belongs to another key, whatever its prefix says.
+var otherKeyErrors = []string{
+	"unable to decrypt",
+	"message authentication failed",
+	"invalid key version",
+}
+
+// rewrapResult is what transit/rewrap made of the ciphertexts of a location.
+type rewrapResult struct {
+	// ciphertexts of the key, with their ciphertext on the latest version
+	rewrapped map[string]string
+	// ciphertexts of other keys
+	other map[string]bool
+	// ciphertexts that couldn't be rewrapped, with the error
+	failed map[string]string
+}
+
+// ciphertexts returns every ciphertext found in s with its key version.
+func ciphertexts(s string) map[string]int {
+	found := map[string]int{}
+	for _, m := range ciphertextRe.FindAllStringSubmatch(s, -1) {
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		found[m[0]] = version
+	}
+	return found
+}
+
+// replace swaps every rewrapped ciphertext in s, returning whether anything
+// changed.
+func replace(s string, rewrapped map[string]string) (string, bool) {
+	changed := false
+	out := ciphertextRe.ReplaceAllStringFunc(s, func(c string) string {
+		if n, ok := rewrapped[c]; ok {
+			changed = true
+			return n
+		}
+		return c
+	})
+	return out, changed
+}
+
+func latestVersion(client *vault.Client, mount, key string) (int, error) {
+	secret, err := client.Logical().Read(fmt.Sprintf("%s/keys/%s", mount, key))
+	if err != nil {
+		return 0, err
+	}
+	if secret == nil || secret.Data == nil {
+		return 0, fmt.Errorf("key %s not found", key)
+	}
+	v, ok := secret.Data["latest_version"].(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("no latest_version for key %s", key)
+	}
+	n, err := v.Int64()
+	return int(n), err
+}
+
+// rewrap sends the ciphertexts to transit/rewrap in batches. Rewrapping
+// doesn't change anything stored, so it is done on dry runs too: it is how
+// the ciphertexts of the key are told apart from the ones of other keys.
+func rewrap(client *vault.Client, mount, key string, found map[string]int, batchSize int) (*rewrapResult, error) {
+	res := &rewrapResult{
+		rewrapped: map[string]string{},
+		other:     map[string]bool{},
+		failed:    map[string]string{},
+	}
+
+	todo := []string{}
+	for c := range found {
+		todo = append(todo, c)
+	}
+	sort.Strings(todo)
+
+	for start := 0; start < len(todo); start += batchSize {
+		end := start + batchSize
+		if end > len(todo) {
+			end = len(todo)
+		}
+		batch := todo[start:end]
+
+		results, err := rewrapBatch(client, mount, key, batch)
+		if err != nil {
+			return nil, err
+		}
+		for i, r := range results {
+			result, _ := r.(map[string]interface{})
+			if e, _ := result["error"].(string); e != "" {
+				if isOtherKey(e) {
+					res.other[batch[i]] = true
+				} else {
+					res.failed[batch[i]] = e
+				}
+				continue
+			}
+			c, _ := result["ciphertext"].(string)
+			if c == "" {
+				res.failed[batch[i]] = "no ciphertext returned"
+				continue
+			}
+			res.rewrapped[batch[i]] = c
+		}
+	}
+
+	return res, nil
+}
+
+// rewrapBatch returns the batch results of one rewrap request. A batch where
+// every ciphertext failed comes back with an error status, the results are
+// in the body all the same.
+func rewrapBatch(client *vault.Client, mount, key string, batch []string) ([]interface{}, error) {
+	input := []map[string]interface{}{}
+	for _, c := range batch {
+		input = append(input, map[string]interface{}{"ciphertext": c})
+	}
+
+	req := client.NewRequest("PUT", fmt.Sprintf("/v1/%s/rewrap/%s", mount, key))
+	if err := req.SetJSONBody(map[string]interface{}{"batch_input": input}); err != nil {
+		return nil, err
+	}
+	resp, err := client.RawRequest(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp == nil {
+		return nil, err
+	}
+
+	secret, parseErr := vault.ParseSecret(resp.Body)
+	if parseErr != nil || secret == nil || secret.Data == nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("empty rewrap response")
+	}
+
+	results, _ := secret.Data["batch_results"].([]interface{})
+	if len(results) != len(batch) {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("rewrap returned %d results for %d ciphertexts", len(results), len(batch))
+	}
+	return results, nil
+}
+
+func isOtherKey(e string) bool {
+	for _, o := range otherKeyErrors {
+		if strings.Contains(e, o) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package vaultrewrap
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	storage "cloud.google.com/go/storage"
+	iterator "google.golang.org/api/iterator"
+	option "google.golang.org/api/option"
+)
+
+// objects bigger than this are not scanned, they are read in memory
+const maxObjectSize = 10 << 20
+
+// metadata keys set by gcs-encrypt: the data key wrapped by the transit key,
+// and the encryption of the body, that then holds no ciphertext
+const (
+	metaEncryption = "encryption"
+	metaWrappedKey = "vault-transit-wrapped-key"
+)
+
+func newStorageClient(ctx context.Context, jsonKeyPath string) (*storage.Client, error) {
+	serviceAccountPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if len(jsonKeyPath) != 0 {
+		serviceAccountPath = jsonKeyPath
+		fmt.Printf("using jsonKeyPath value %s\n", jsonKeyPath)
+	}
+
+	if _, err := os.Stat(serviceAccountPath); len(serviceAccountPath) != 0 && err == nil {
+		return storage.NewClient(ctx, option.WithCredentialsFile(serviceAccountPath))
+	}
+	fmt.Println("jsonkey empty, not using creds option")
+	return storage.NewClient(ctx)
+}
+
+// rewrapObjects looks for ciphertexts in every object under the prefix, in
+// its body and in the data key wrapped by gcs-encrypt, and rewraps them one
+// object at a time, so that a single body is held in memory. Noncurrent
+// generations of a versioned bucket can't be rewritten, their ciphertexts are
+// counted as previous.
+func rewrapObjects(ctx context.Context, storageClient *storage.Client, rw *rewrapper) error {
+	bucket := storageClient.Bucket(rw.rb.Bucket)
+	bucketAttrs, err := bucket.Attrs(ctx)
+	if err != nil {
+		return err
+	}
+
+	it := bucket.Objects(ctx, &storage.Query{Prefix: rw.rb.Prefix, Versions: true})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rw.payload.ObjectsScanned++
+		noncurrent := !attrs.Deleted.IsZero()
+		name := fmt.Sprintf("gs://%s/%s", rw.rb.Bucket, attrs.Name)
+		if noncurrent {
+			name = fmt.Sprintf("%s#%d", name, attrs.Generation)
+		}
+
+		found, body, ok := scanObject(ctx, bucket, attrs, name, rw.payload)
+		if !ok || len(found) == 0 {
+			continue
+		}
+		if noncurrent {
+			rw.countPrevious(name, found)
+			continue
+		}
+		rw.rewrapLocation(name, found, func(rewrapped map[string]string) (bool, error) {
+			// a versioned bucket keeps the generation replaced as noncurrent
+			newGeneration, err := writeObject(ctx, bucket.Object(attrs.Name), attrs, body, rewrapped)
+			return newGeneration && bucketAttrs.VersioningEnabled, err
+		})
+	}
+}
+
+// scanObject returns the ciphertexts of an object generation and its body,
+// if it was read: the bodies encrypted by gcs-encrypt hold no ciphertext and
+// the ones too big are skipped.
+func scanObject(ctx context.Context, bucket *storage.BucketHandle, attrs *storage.ObjectAttrs, name string, payload *Payload) (map[string]int, string, bool) {
+	found := ciphertexts(attrs.Metadata[metaWrappedKey])
+	if _, encrypted := attrs.Metadata[metaEncryption]; encrypted {
+		return found, "", true
+	}
+	if attrs.Size > maxObjectSize {
+		payload.Skipped = append(payload.Skipped, fmt.Sprintf("%s: too big to scan", name))
+		return found, "", true
+	}
+
+	body, err := readObject(ctx, bucket.Object(attrs.Name).Generation(attrs.Generation))
+	if err != nil {
+		fmt.Printf("Error reading %s: %s\n", name, err)
+		payload.Errors = append(payload.Errors, fmt.Sprintf("%s: %s", name, err))
+		return nil, "", false
+	}
+	for c, v := range ciphertexts(body) {
+		found[c] = v
+	}
+	return found, body, true
+}
+
+func readObject(ctx context.Context, o *storage.ObjectHandle) (string, error) {
+	rc, err := o.NewReader(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	body, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// writeObject writes the rewrapped ciphertexts back only if the object wasn't
+// changed since it was read: a new generation if they are in the body, a
+// metadata update if only the wrapped data key changed, that replaces it in
+// place. It returns whether a new generation was written.
+func writeObject(ctx context.Context, o *storage.ObjectHandle, attrs *storage.ObjectAttrs, body string, rewrapped map[string]string) (bool, error) {
+	metadata := map[string]string{}
+	for k, v := range attrs.Metadata {
+		metadata[k] = v
+	}
+	wrapped, keyChanged := replace(metadata[metaWrappedKey], rewrapped)
+	if keyChanged {
+		metadata[metaWrappedKey] = wrapped
+	}
+
+	body, bodyChanged := replace(body, rewrapped)
+	if !bodyChanged {
+		_, err := o.If(storage.Conditions{MetagenerationMatch: attrs.Metageneration}).Update(ctx, storage.ObjectAttrsToUpdate{
+			Metadata: map[string]string{metaWrappedKey: wrapped},
+		})
+		return false, err
+	}
+
+	wc := o.If(storage.Conditions{GenerationMatch: attrs.Generation}).NewWriter(ctx)
+	wc.ContentType = attrs.ContentType
+	wc.Metadata = metadata
+	if _, err := wc.Write([]byte(body)); err != nil {
+		wc.Close()
+		return false, err
+	}
+	return true, wc.Close()
+}
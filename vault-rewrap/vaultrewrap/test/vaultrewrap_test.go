@@ -0,0 +1,291 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	network "github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/efbar/more-serverless/vault-rewrap/vaultrewrap"
+	vault "github.com/hashicorp/vault/api"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const vaultServerPort = "1234"
+
+func TestFunc(t *testing.T) {
+
+	// the version 1 of the secrets, kept by kv version 2 when they are
+	// rewrapped, holds v1 ciphertexts until it is destroyed
+	tt := []struct {
+		contentType string
+		dryRun      bool
+		destroy     bool
+		rewrapped   int
+		foundV1     int
+		previousV1  int
+		minVersion  int
+	}{
+		{
+			contentType: "text/plain",
+			dryRun:      true,
+			minVersion:  1,
+		},
+		{
+			contentType: "application/json",
+			rewrapped:   2,
+			foundV1:     2,
+			previousV1:  2,
+			minVersion:  1,
+		},
+		{
+			contentType: "text/plain",
+			minVersion:  1,
+		},
+		{
+			contentType: "application/json",
+			destroy:     true,
+			minVersion:  2,
+		},
+	}
+
+	cli, err := client.NewClientWithOpts()
+	if err != nil {
+		fmt.Printf("Can't instantiate docker client: %s", err.Error())
+	}
+
+	resp, err := startContainerService(cli, "vault")
+	if err != nil {
+		t.Logf("Can't create container: %s", err.Error())
+	}
+	t.Log(resp.ID)
+	defer removeContainerService(cli, resp.ID)
+
+	conf := vault.DefaultConfig()
+	conf.Address = "http://127.0.0.1:" + vaultServerPort
+	vaultClient, err := vault.NewClient(conf)
+	if err != nil {
+		t.Logf("Can't initiate client: %s", err.Error())
+	}
+
+	vaultClient.SetToken("root")
+
+	err = vaultClient.Sys().Mount("transit/", &vault.MountInput{Type: "transit"})
+	if err != nil {
+		t.Fatalf("Error in mounting transit: %s", err.Error())
+	}
+	_, err = vaultClient.Logical().Write("transit/keys/rewrap-test", nil)
+	if err != nil {
+		t.Fatalf("Error creating key: %s", err.Error())
+	}
+
+	// a ciphertext of another key looks just the same
+	_, err = vaultClient.Logical().Write("transit/keys/other-key", nil)
+	if err != nil {
+		t.Fatalf("Error creating key: %s", err.Error())
+	}
+
+	encrypt := func(key, plaintext string) string {
+		secret, err := vaultClient.Logical().Write("transit/encrypt/"+key, map[string]interface{}{
+			"plaintext": base64.StdEncoding.EncodeToString([]byte(plaintext)),
+		})
+		if err != nil {
+			t.Fatalf("Error encrypting: %s", err.Error())
+		}
+		return secret.Data["ciphertext"].(string)
+	}
+
+	// the dev server mounts secret/ as kv version 2
+	secrets := []struct {
+		path string
+		data map[string]interface{}
+	}{
+		{"secret/data/app/db", map[string]interface{}{"password": encrypt("rewrap-test", "first"), "user": "admin"}},
+		{"secret/data/app/nested/api", map[string]interface{}{"keys": []interface{}{encrypt("rewrap-test", "second")}}},
+		{"secret/data/app/other", map[string]interface{}{"token": encrypt("other-key", "third")}},
+		{"secret/data/app/plain", map[string]interface{}{"key": "foo"}},
+	}
+	for _, s := range secrets {
+		_, err = vaultClient.Logical().Write(s.path, map[string]interface{}{"data": s.data})
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Error writing secret: %s", err))
+		}
+	}
+
+	_, err = vaultClient.Logical().Write("transit/keys/rewrap-test/rotate", nil)
+	if err != nil {
+		t.Fatalf("Error rotating key: %s", err.Error())
+	}
+
+	for _, tr := range tt {
+		t.Log(tr.dryRun)
+
+		if tr.destroy {
+			for _, path := range []string{"secret/destroy/app/db", "secret/destroy/app/nested/api"} {
+				_, err = vaultClient.Logical().Write(path, map[string]interface{}{"versions": []int{1}})
+				if err != nil {
+					t.Fatalf("Error destroying version: %s", err.Error())
+				}
+			}
+		}
+
+		jsonStruct := map[string]interface{}{
+			"endpoint": "http://127.0.0.1:" + vaultServerPort,
+			"token":    "root",
+			"key":      "rewrap-test",
+			"kvPath":   "secret/app",
+			"dryRun":   tr.dryRun,
+		}
+
+		jsonBody, _ := json.Marshal(jsonStruct)
+		req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
+		req.Header.Set("Content-Type", tr.contentType)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(vaultrewrap.Serve)
+
+		handler.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, http.StatusOK)
+		}
+
+		if tr.contentType == "application/json" {
+			res := vaultrewrap.Response{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+				t.Fatalf("can't parse response: %s", err)
+			}
+			if res.Payload.Rewrapped != tr.rewrapped {
+				t.Errorf("wrong number of ciphertexts rewrapped: got %d want %d", res.Payload.Rewrapped, tr.rewrapped)
+			}
+			if res.Payload.MinDecryptionVersion != tr.minVersion {
+				t.Errorf("wrong safe min_decryption_version: got %d want %d", res.Payload.MinDecryptionVersion, tr.minVersion)
+			}
+			if res.Payload.OtherKeys["v1"] != 1 || res.Payload.Found["v1"] != tr.foundV1 {
+				t.Errorf("ciphertext of another key counted: found %v, other keys %v", res.Payload.Found, res.Payload.OtherKeys)
+			}
+			if res.Payload.Previous["v1"] != tr.previousV1 {
+				t.Errorf("wrong previous versions: got %v want %d v1", res.Payload.Previous, tr.previousV1)
+			}
+		}
+
+		fmt.Printf("response body: \n%s\n", rr.Body)
+	}
+
+	rewrapped, err := vaultClient.Logical().Read("secret/data/app/db")
+	if err != nil || rewrapped == nil {
+		t.Fatalf("rewrapped secret not found: %v", err)
+	}
+	data := rewrapped.Data["data"].(map[string]interface{})
+	if password, _ := data["password"].(string); !strings.HasPrefix(password, "vault:v2:") {
+		t.Errorf("secret not rewrapped: %s", password)
+	}
+	if data["user"] != "admin" {
+		t.Errorf("other values changed: %v", data["user"])
+	}
+
+	other, err := vaultClient.Logical().Read("secret/data/app/other")
+	if err != nil || other == nil {
+		t.Fatalf("other secret not found: %v", err)
+	}
+	if token := other.Data["data"].(map[string]interface{})["token"]; token != secrets[2].data["token"] {
+		t.Errorf("ciphertext of another key changed: %v", token)
+	}
+}
+
+func startContainerService(cli *client.Client, containerName string) (*container.ContainerCreateCreatedBody, error) {
+	// context
+	ctx := context.Background()
+
+	// config
+	config := &container.Config{
+		Image: containerName,
+		ExposedPorts: nat.PortSet{
+			"8200/tcp": struct{}{},
+		},
+		Cmd: []string{"server", "-dev", fmt.Sprintf("-dev-root-token-id=%s", "root"), "-dev-listen-address=0.0.0.0:8200"},
+	}
+
+	hostConfig := &container.HostConfig{
+		Binds: []string{
+			"/var/run/docker.sock:/var/run/docker.sock",
+		},
+		PortBindings: nat.PortMap{
+			"8200/tcp": []nat.PortBinding{
+				{
+					HostIP:   "127.0.0.1",
+					HostPort: vaultServerPort,
+				},
+			},
+		},
+		RestartPolicy: container.RestartPolicy{
+			Name: "always",
+		},
+		LogConfig: container.LogConfig{
+			Type:   "json-file",
+			Config: map[string]string{},
+		},
+	}
+
+	networkConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{},
+	}
+	gatewayConfig := &network.EndpointSettings{
+		Gateway: "gatewayname",
+	}
+	networkConfig.EndpointsConfig["bridge"] = gatewayConfig
+
+	resp, err := cli.ContainerCreate(
+		ctx,
+		config,
+		hostConfig,
+		networkConfig,
+		&v1.Platform{
+			Architecture: "amd64",
+			OS:           "linux",
+		},
+		containerName,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func removeContainerService(cli *client.Client, containerName string) {
+	ctx := context.Background()
+
+	err := cli.ContainerStop(ctx, containerName, nil)
+	if err != nil {
+		fmt.Printf("Can't stop container: %s", err.Error())
+		return
+	}
+
+	removeOptions := types.ContainerRemoveOptions{
+		RemoveVolumes: true,
+		Force:         true,
+	}
+	err = cli.ContainerRemove(ctx, containerName, removeOptions)
+	if err != nil {
+		fmt.Printf("Can't remove container: %s", err.Error())
+		return
+	}
+
+}
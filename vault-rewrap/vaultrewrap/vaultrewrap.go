@@ -0,0 +1,483 @@
+package vaultrewrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	storage "cloud.google.com/go/storage"
+	vaultkv "github.com/efbar/more-serverless/vault-kv/vaultkv"
+	vault "github.com/hashicorp/vault/api"
+	"github.com/ryanuber/columnize"
+)
+
+const (
+	defaultMount     = "transit"
+	defaultBatchSize = 100
+)
+
+type RequestBody struct {
+	Token       string `json:"token"`
+	Endpoint    string `json:"endpoint"`
+	Mount       string `json:"mount,omitempty"`
+	Key         string `json:"key"`
+	KvPath      string `json:"kvPath,omitempty"`
+	Bucket      string `json:"bucket,omitempty"`
+	Prefix      string `json:"prefix,omitempty"`
+	JsonKeyPath string `json:"jsonKeyPath,omitempty"`
+	BatchSize   int    `json:"batchSize,omitempty"`
+	DryRun      bool   `json:"dryRun,omitempty"`
+}
+
+type Payload struct {
+	Key                  string         `json:"key"`
+	LatestVersion        int            `json:"latest_version"`
+	DryRun               bool           `json:"dry_run"`
+	SecretsScanned       int            `json:"secrets_scanned"`
+	ObjectsScanned       int            `json:"objects_scanned"`
+	Found                map[string]int `json:"found"`
+	Remaining            map[string]int `json:"remaining"`
+	Previous             map[string]int `json:"previous_versions"`
+	OtherKeys            map[string]int `json:"other_keys"`
+	Rewrapped            int            `json:"rewrapped"`
+	Updated              []string       `json:"updated"`
+	Skipped              []string       `json:"skipped,omitempty"`
+	Errors               []string       `json:"errors,omitempty"`
+	MinDecryptionVersion int            `json:"safe_min_decryption_version,omitempty"`
+	Unsafe               string         `json:"safe_min_decryption_version_unknown,omitempty"`
+}
+
+type Response struct {
+	Payload Payload             `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+// rewrapper rewraps the ciphertexts of one KV secret or GCS object at a
+// time and counts them in payload.
+type rewrapper struct {
+	client  *vault.Client
+	rb      *RequestBody
+	payload *Payload
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+	if len(rb.Key) == 0 {
+		fmt.Println("empty key")
+		http.Error(w, "empty key", http.StatusBadRequest)
+		return
+	}
+	if len(rb.KvPath) == 0 && len(rb.Bucket) == 0 {
+		fmt.Println("empty kvPath and bucket")
+		http.Error(w, "one of kvPath or bucket is required", http.StatusBadRequest)
+		return
+	}
+	if len(rb.Mount) == 0 {
+		rb.Mount = defaultMount
+	}
+	if rb.BatchSize <= 0 {
+		rb.BatchSize = defaultBatchSize
+	}
+
+	conf := vault.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rb.Token != "" {
+		client.SetToken(rb.Token)
+	}
+
+	latest, err := latestVersion(client, rb.Mount, rb.Key)
+	if err != nil {
+		fmt.Println("Error reading transit key:", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payload := Payload{
+		Key:           rb.Key,
+		LatestVersion: latest,
+		DryRun:        rb.DryRun,
+		Found:         map[string]int{},
+		Remaining:     map[string]int{},
+		Previous:      map[string]int{},
+		OtherKeys:     map[string]int{},
+		Updated:       []string{},
+	}
+	rw := &rewrapper{client: client, rb: &rb, payload: &payload}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	var storageClient *storage.Client
+	if len(rb.Bucket) != 0 {
+		storageClient, err = newStorageClient(ctx, rb.JsonKeyPath)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer storageClient.Close()
+	}
+
+	// KV secrets
+	if len(rb.KvPath) != 0 {
+		store, root, err := vaultkv.New(client, rb.KvPath)
+		if err != nil {
+			fmt.Println("Error on kvPath:", err.Error())
+			http.Error(w, fmt.Sprintf("kvPath: %s", err), http.StatusBadRequest)
+			return
+		}
+		rels, err := store.Walk(root)
+		if err != nil {
+			fmt.Println("Error listing secrets:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, rel := range rels {
+			payload.SecretsScanned++
+			rewrapSecret(rw, store, rel)
+		}
+	}
+
+	// GCS objects
+	if storageClient != nil {
+		if err := rewrapObjects(ctx, storageClient, rw); err != nil {
+			fmt.Printf("Bucket(%q).Objects: %v\n", rb.Bucket, err)
+			payload.Errors = append(payload.Errors, fmt.Sprintf("gs://%s/%s: %s", rb.Bucket, rb.Prefix, err))
+		}
+	}
+
+	summarize(&payload)
+
+	resBody := ""
+	if r.Header.Get("Content-Type") == "text/plain" {
+		out := []string{"Key Version\tFound\tRemaining\tPrevious Versions\tOther Keys"}
+		for _, v := range versionKeys(payload.Found, payload.Remaining, payload.Previous, payload.OtherKeys) {
+			out = append(out, fmt.Sprintf("%s\t%d\t%d\t%d\t%d", v, payload.Found[v], payload.Remaining[v], payload.Previous[v], payload.OtherKeys[v]))
+		}
+		out = append(out, "")
+		out = append(out, fmt.Sprintf("Transit key\t%s/%s, latest version %d", rb.Mount, rb.Key, latest))
+		out = append(out, fmt.Sprintf("Scanned\t%d secrets, %d objects", payload.SecretsScanned, payload.ObjectsScanned))
+		out = append(out, fmt.Sprintf("Rewrapped\t%d ciphertexts", payload.Rewrapped))
+		out = append(out, fmt.Sprintf("Updated\t%d secrets and objects", len(payload.Updated)))
+		if rb.DryRun {
+			out = append(out, "Dry run\tnothing written")
+		}
+		if payload.MinDecryptionVersion != 0 {
+			out = append(out, fmt.Sprintf("Safe min_decryption_version\t%d", payload.MinDecryptionVersion))
+		} else {
+			out = append(out, fmt.Sprintf("Safe min_decryption_version\tunknown, %s", payload.Unsafe))
+		}
+		for _, o := range payload.Skipped {
+			out = append(out, fmt.Sprintf("Skipped\t%s", o))
+		}
+		for _, e := range payload.Errors {
+			out = append(out, fmt.Sprintf("Error\t%s", e))
+		}
+
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "    "
+		columnConf.NoTrim = false
+		resBody = columnize.Format(out, columnConf)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+// stringValues returns every string found in a secret, nested ones included.
+func stringValues(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case map[string]interface{}:
+		values := []string{}
+		for _, e := range t {
+			values = append(values, stringValues(e)...)
+		}
+		return values
+	case []interface{}:
+		values := []string{}
+		for _, e := range t {
+			values = append(values, stringValues(e)...)
+		}
+		return values
+	}
+	return nil
+}
+
+// replaceValue swaps the rewrapped ciphertexts in every string of a secret,
+// returning whether anything changed.
+func replaceValue(v interface{}, rewrapped map[string]string) (interface{}, bool) {
+	switch t := v.(type) {
+	case string:
+		return replace(t, rewrapped)
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		changed := false
+		for k, e := range t {
+			n, c := replaceValue(e, rewrapped)
+			out[k] = n
+			changed = changed || c
+		}
+		return out, changed
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		changed := false
+		for i, e := range t {
+			n, c := replaceValue(e, rewrapped)
+			out[i] = n
+			changed = changed || c
+		}
+		return out, changed
+	}
+	return v, false
+}
+
+// rewrapSecret rewraps the latest version of a KV secret and, on KV v2,
+// counts the ciphertexts left in its previous versions: they can't be
+// rewritten, only destroyed.
+func rewrapSecret(rw *rewrapper, store *vaultkv.KV, rel string) {
+	name := store.Mount + rel
+	data, version, err := store.Read(rel, 0)
+	if err != nil {
+		fmt.Printf("Error reading %s: %s\n", name, err)
+		rw.payload.Errors = append(rw.payload.Errors, fmt.Sprintf("%s: %s", name, err))
+		return
+	}
+	if found := secretCiphertexts(data); len(found) != 0 {
+		rw.rewrapLocation(name, found, func(rewrapped map[string]string) (bool, error) {
+			replaced, _ := replaceValue(data, rewrapped)
+			// on KV v2 the version read stays there after the write
+			return store.Version == 2, store.WriteCAS(rel, replaced.(map[string]interface{}), version)
+		})
+	}
+	if store.Version != 2 {
+		return
+	}
+
+	versions, err := store.Versions(rel)
+	if err == nil {
+		var deleted []int
+		deleted, err = store.DeletedVersions(rel)
+		for _, v := range deleted {
+			rw.payload.Skipped = append(rw.payload.Skipped, fmt.Sprintf("%s version %d: deleted, can't be scanned", name, v))
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error reading versions of %s: %s\n", name, err)
+		rw.payload.Errors = append(rw.payload.Errors, fmt.Sprintf("%s: %s", name, err))
+		return
+	}
+	for _, v := range versions {
+		if v == version {
+			continue
+		}
+		previous := fmt.Sprintf("%s version %d", name, v)
+		data, _, err := store.Read(rel, v)
+		if err != nil {
+			fmt.Printf("Error reading %s: %s\n", previous, err)
+			rw.payload.Errors = append(rw.payload.Errors, fmt.Sprintf("%s: %s", previous, err))
+			continue
+		}
+		if found := secretCiphertexts(data); len(found) != 0 {
+			rw.countPrevious(previous, found)
+		}
+	}
+}
+
+func secretCiphertexts(data map[string]interface{}) map[string]int {
+	found := map[string]int{}
+	for _, s := range stringValues(data) {
+		for c, v := range ciphertexts(s) {
+			found[c] = v
+		}
+	}
+	return found
+}
+
+// probe rewraps the ciphertexts found in a location to tell the ones of the
+// key from the ones of other keys, nil if it failed.
+func (rw *rewrapper) probe(name string, found map[string]int) *rewrapResult {
+	res, err := rewrap(rw.client, rw.rb.Mount, rw.rb.Key, found, rw.rb.BatchSize)
+	if err != nil {
+		fmt.Printf("Error rewrapping %s: %s\n", name, err)
+		rw.payload.Errors = append(rw.payload.Errors, fmt.Sprintf("%s: rewrap: %s", name, err))
+		return nil
+	}
+	failed := []string{}
+	for c, e := range res.failed {
+		failed = append(failed, fmt.Sprintf("%s: rewrap %s...: %s", name, c[:strings.LastIndex(c, ":")+1], e))
+	}
+	sort.Strings(failed)
+	rw.payload.Errors = append(rw.payload.Errors, failed...)
+	return res
+}
+
+// countPrevious counts the ciphertexts of a previous KV version or a
+// noncurrent object generation, that can't be rewritten.
+func (rw *rewrapper) countPrevious(name string, found map[string]int) {
+	res := rw.probe(name, found)
+	if res == nil {
+		return
+	}
+	for c, v := range found {
+		if res.other[c] {
+			rw.payload.OtherKeys[versionKey(v)]++
+			continue
+		}
+		rw.payload.Previous[versionKey(v)]++
+	}
+}
+
+// rewrapLocation rewraps the ciphertexts found in a location and, unless on
+// a dry run, calls write with the new ciphertext of the ones of the key on an
+// old version, to write the location back. Then it counts them; if write says
+// that what was overwritten is kept, as a previous version or a noncurrent
+// generation, the old ciphertexts count as previous too.
+func (rw *rewrapper) rewrapLocation(name string, found map[string]int, write func(map[string]string) (bool, error)) {
+	latest := rw.payload.LatestVersion
+
+	res := rw.probe(name, found)
+	if res == nil {
+		return
+	}
+
+	outdated := map[string]string{}
+	for c, n := range res.rewrapped {
+		if found[c] < latest {
+			outdated[c] = n
+		}
+	}
+
+	written, keepsPrevious := false, false
+	if !rw.rb.DryRun && len(outdated) != 0 {
+		kept, err := write(outdated)
+		if err != nil {
+			fmt.Printf("Error writing %s: %s\n", name, err)
+			rw.payload.Errors = append(rw.payload.Errors, fmt.Sprintf("%s: %s", name, err))
+		} else {
+			written, keepsPrevious = true, kept
+			rw.payload.Rewrapped += len(outdated)
+			rw.payload.Updated = append(rw.payload.Updated, name)
+		}
+	}
+
+	// a ciphertext only counts as moved to the latest version if its
+	// location was written back
+	for c, v := range found {
+		if res.other[c] {
+			rw.payload.OtherKeys[versionKey(v)]++
+			continue
+		}
+		rw.payload.Found[versionKey(v)]++
+		if _, ok := outdated[c]; ok && written {
+			if keepsPrevious {
+				rw.payload.Previous[versionKey(v)]++
+			}
+			v = latest
+		}
+		rw.payload.Remaining[versionKey(v)]++
+	}
+}
+
+// summarize sets the highest min_decryption_version that can be set without
+// losing data, the lowest key version remaining, previous KV versions and
+// noncurrent object generations included. If anything was skipped or
+// failed, ciphertexts on older versions may be left where they weren't seen,
+// so it is left unset with the reason.
+func summarize(payload *Payload) {
+	reasons := []string{}
+	if len(payload.Skipped) != 0 {
+		reasons = append(reasons, fmt.Sprintf("%d secret versions or objects not scanned", len(payload.Skipped)))
+	}
+	if len(payload.Errors) != 0 {
+		reasons = append(reasons, fmt.Sprintf("%d errors", len(payload.Errors)))
+	}
+	if len(reasons) != 0 {
+		payload.Unsafe = strings.Join(reasons, " and ")
+		return
+	}
+
+	payload.MinDecryptionVersion = payload.LatestVersion
+	if versions := versionKeys(payload.Remaining, payload.Previous); len(versions) != 0 {
+		payload.MinDecryptionVersion, _ = strconv.Atoi(strings.TrimPrefix(versions[0], "v"))
+	}
+}
+
+func versionKey(v int) string {
+	return "v" + strconv.Itoa(v)
+}
+
+// versionKeys returns the versions found in any of counts, in ascending
+// order.
+func versionKeys(counts ...map[string]int) []string {
+	set := map[int]bool{}
+	for _, c := range counts {
+		for k := range c {
+			if v, err := strconv.Atoi(strings.TrimPrefix(k, "v")); err == nil {
+				set[v] = true
+			}
+		}
+	}
+	versions := []int{}
+	for v := range set {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+
+	keys := []string{}
+	for _, v := range versions {
+		keys = append(keys, versionKey(v))
+	}
+	return keys
+}
@@ -0,0 +1,11 @@
+package function
+
+import (
+	"net/http"
+
+	vaultsnapshot "github.com/efbar/more-serverless/vault-snapshot/vaultsnapshot"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	vaultsnapshot.Serve(w, r)
+}
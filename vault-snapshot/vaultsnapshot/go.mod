@@ -0,0 +1,15 @@
+module github.com/efbar/more-serverless/vault-snapshot/vaultsnapshot
+
+go 1.16
+
+require (
+	cloud.google.com/go/storage v1.15.0
+	github.com/efbar/more-serverless/gcs-snapshot/gcssnapshot v0.0.0-00010101000000-000000000000
+	github.com/efbar/more-serverless/slack-message/slackmessage v0.0.0-00010101000000-000000000000
+	github.com/hashicorp/vault/api v1.1.0
+	github.com/ryanuber/columnize v2.1.2+incompatible
+)
+
+replace github.com/efbar/more-serverless/slack-message/slackmessage => ../../slack-message/slackmessage
+
+replace github.com/efbar/more-serverless/gcs-snapshot/gcssnapshot => ../../gcs-snapshot/gcssnapshot
@@ -0,0 +1,69 @@
+package vaultsnapshot
+
+import (
+	"context"
+	"io"
+	"time"
+
+	storage "cloud.google.com/go/storage"
+	gcssnapshot "github.com/efbar/more-serverless/gcs-snapshot/gcssnapshot"
+	vault "github.com/hashicorp/vault/api"
+)
+
+func snapshotStore(storageClient *storage.Client, rb *RequestBody) *gcssnapshot.Store {
+	return &gcssnapshot.Store{
+		Client: storageClient,
+		Bucket: rb.Bucket,
+		Prefix: rb.Prefix,
+		Name:   "vault-snapshot",
+	}
+}
+
+// saveSnapshot streams the raft snapshot straight into a new object.
+func saveSnapshot(ctx context.Context, client *vault.Client, storageClient *storage.Client, rb *RequestBody) (*Snapshot, error) {
+	object, err := snapshotStore(storageClient, rb).Save(ctx, "application/octet-stream", map[string]string{"vault-endpoint": rb.Endpoint}, func(w io.Writer) error {
+		return client.Sys().RaftSnapshot(w)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{
+		Object:  object.Name,
+		Size:    object.Size,
+		Created: object.Created.Format(time.RFC3339),
+	}, nil
+}
+
+func restoreSnapshot(ctx context.Context, client *vault.Client, storageClient *storage.Client, rb *RequestBody) error {
+	rc, err := snapshotStore(storageClient, rb).Open(ctx, rb.Object)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return client.Sys().RaftSnapshotRestore(rc, rb.Force)
+}
+
+// listSnapshots returns the snapshots under the prefix, newest first.
+func listSnapshots(ctx context.Context, storageClient *storage.Client, rb *RequestBody) ([]Snapshot, error) {
+	objects, err := snapshotStore(storageClient, rb).List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []Snapshot{}
+	for _, o := range objects {
+		snapshots = append(snapshots, Snapshot{
+			Object:  o.Name,
+			Size:    o.Size,
+			Created: o.Created.Format(time.RFC3339),
+		})
+	}
+	return snapshots, nil
+}
+
+// pruneSnapshots deletes every snapshot but the newest rb.Retain ones.
+func pruneSnapshots(ctx context.Context, storageClient *storage.Client, rb *RequestBody) ([]string, error) {
+	return snapshotStore(storageClient, rb).Prune(ctx, rb.Retain)
+}
@@ -0,0 +1,398 @@
+package vaultstatus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/ryanuber/columnize"
+)
+
+const defaultMaxIndexLag = 100
+
+type NodeStatus struct {
+	NodeID             string `json:"node_id,omitempty"`
+	Address            string `json:"address"`
+	Reachable          bool   `json:"reachable"`
+	Error              string `json:"error,omitempty"`
+	Initialized        bool   `json:"initialized"`
+	Sealed             bool   `json:"sealed"`
+	Version            string `json:"version,omitempty"`
+	HAMode             string `json:"ha_mode,omitempty"`
+	LeaderAddress      string `json:"leader_address,omitempty"`
+	RaftCommittedIndex uint64 `json:"raft_committed_index"`
+	RaftAppliedIndex   uint64 `json:"raft_applied_index"`
+	IndexLag           uint64 `json:"index_lag"`
+	AutopilotStatus    string `json:"autopilot_status,omitempty"`
+	AutopilotHealthy   *bool  `json:"autopilot_healthy,omitempty"`
+	LastContact        string `json:"last_contact,omitempty"`
+}
+
+type ClusterStatus struct {
+	Nodes            []NodeStatus `json:"nodes"`
+	Leader           string       `json:"leader,omitempty"`
+	AutopilotHealthy *bool        `json:"autopilot_healthy,omitempty"`
+	FailureTolerance int          `json:"failure_tolerance,omitempty"`
+	AutopilotError   string       `json:"autopilot_error,omitempty"`
+	Verdict          string       `json:"verdict"`
+	Reasons          []string     `json:"reasons,omitempty"`
+}
+
+type ClusterResponse struct {
+	Payload ClusterStatus       `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func serveCluster(w http.ResponseWriter, r *http.Request, rb *RequestBody) {
+	nodes := map[string]string{}
+	for _, n := range rb.Nodes {
+		nodes[n] = ""
+	}
+
+	if rb.Discover {
+		peers, err := raftPeers(rb)
+		if err != nil {
+			fmt.Println("error discovering raft peers:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for address, id := range peers {
+			nodes[address] = id
+		}
+	}
+
+	if len(nodes) == 0 {
+		fmt.Println("no nodes")
+		http.Error(w, "no nodes", http.StatusBadRequest)
+		return
+	}
+
+	status := ClusterStatus{}
+	for address, id := range nodes {
+		node := nodeStatus(address, rb.Token)
+		node.NodeID = id
+		status.Nodes = append(status.Nodes, node)
+	}
+	sort.Slice(status.Nodes, func(i, j int) bool {
+		return status.Nodes[i].Address < status.Nodes[j].Address
+	})
+
+	autopilot(&status, rb)
+
+	maxLag := rb.MaxIndexLag
+	if maxLag == 0 {
+		maxLag = defaultMaxIndexLag
+	}
+	verdict(&status, maxLag)
+
+	code := http.StatusOK
+	if status.Verdict != "healthy" {
+		code = http.StatusServiceUnavailable
+	}
+
+	if r.Header.Get("Content-Type") == "text/plain" {
+		out := []string{"Node\tAddress\tInitialized\tSealed\tHA Mode\tVersion\tCommitted\tApplied\tLag\tAutopilot"}
+		for _, n := range status.Nodes {
+			if !n.Reachable {
+				out = append(out, fmt.Sprintf("%s\t%s\t-\t-\tunreachable\t-\t-\t-\t-\t%s", orNone(n.NodeID), n.Address, orNone(n.AutopilotStatus)))
+				continue
+			}
+			out = append(out, fmt.Sprintf("%s\t%s\t%t\t%t\t%s\t%s\t%d\t%d\t%d\t%s",
+				orNone(n.NodeID), n.Address, n.Initialized, n.Sealed, orNone(n.HAMode), n.Version,
+				n.RaftCommittedIndex, n.RaftAppliedIndex, n.IndexLag, orNone(n.AutopilotStatus)))
+		}
+		out = append(out, "")
+		out = append(out, fmt.Sprintf("Leader\t%s", orNone(status.Leader)))
+		if status.AutopilotHealthy != nil {
+			out = append(out, fmt.Sprintf("Autopilot Healthy\t%t", *status.AutopilotHealthy))
+			out = append(out, fmt.Sprintf("Failure Tolerance\t%d", status.FailureTolerance))
+		} else if status.AutopilotError != "" {
+			out = append(out, fmt.Sprintf("Autopilot\t%s", status.AutopilotError))
+		}
+		out = append(out, fmt.Sprintf("Verdict\t%s", status.Verdict))
+		for _, reason := range status.Reasons {
+			out = append(out, fmt.Sprintf("\t%s", reason))
+		}
+
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "    "
+		columnConf.NoTrim = false
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(code)
+		w.Write([]byte(columnize.Format(out, columnConf)))
+	} else {
+		jsonResponse := ClusterResponse{
+			Payload: status,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(code)
+		w.Write(resBody)
+	}
+}
+
+// raftPeers reads the raft configuration from the endpoint and returns the
+// API address of every peer, keyed to its node id. Raft only knows cluster
+// addresses, so the scheme and port of the endpoint are used for each peer.
+func raftPeers(rb *RequestBody) (map[string]string, error) {
+	if len(rb.Endpoint) == 0 {
+		return nil, fmt.Errorf("empty endpoint")
+	}
+
+	endpoint, err := url.Parse(rb.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newClient(rb.Endpoint, rb.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := client.Logical().Read("sys/storage/raft/configuration")
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("empty raft configuration")
+	}
+
+	config, _ := secret.Data["config"].(map[string]interface{})
+	servers, _ := config["servers"].([]interface{})
+
+	peers := map[string]string{}
+	for _, s := range servers {
+		server, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		address, _ := server["address"].(string)
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		apiAddress := fmt.Sprintf("%s://%s", endpoint.Scheme, host)
+		if port := endpoint.Port(); port != "" {
+			apiAddress = fmt.Sprintf("%s://%s", endpoint.Scheme, net.JoinHostPort(host, port))
+		}
+		id, _ := server["node_id"].(string)
+		peers[apiAddress] = id
+	}
+
+	return peers, nil
+}
+
+func nodeStatus(address, token string) NodeStatus {
+	node := NodeStatus{Address: address}
+
+	client, err := newClient(address, token)
+	if err != nil {
+		node.Error = err.Error()
+		return node
+	}
+
+	seal, err := client.Sys().SealStatus()
+	if err != nil {
+		node.Error = err.Error()
+		return node
+	}
+	node.Reachable = true
+	node.Initialized = seal.Initialized
+	node.Sealed = seal.Sealed
+	node.Version = seal.Version
+
+	if seal.Sealed {
+		node.HAMode = "sealed"
+		return node
+	}
+
+	leader, err := client.Sys().Leader()
+	if err != nil {
+		node.Error = err.Error()
+		return node
+	}
+	node.HAMode = "standby"
+	if leader.IsSelf || !leader.HAEnabled {
+		node.HAMode = "active"
+	} else if leader.PerfStandby {
+		node.HAMode = "perf-standby"
+	}
+	node.LeaderAddress = leader.LeaderAddress
+	node.RaftCommittedIndex = leader.RaftCommittedIndex
+	node.RaftAppliedIndex = leader.RaftAppliedIndex
+
+	return node
+}
+
+// autopilot merges the autopilot state, as seen by the endpoint or the first
+// unsealed node, into the cluster status.
+func autopilot(status *ClusterStatus, rb *RequestBody) {
+	address := rb.Endpoint
+	if len(address) == 0 {
+		for _, n := range status.Nodes {
+			if n.Reachable && !n.Sealed {
+				address = n.Address
+				break
+			}
+		}
+	}
+	if len(address) == 0 {
+		return
+	}
+
+	client, err := newClient(address, rb.Token)
+	if err != nil {
+		status.AutopilotError = err.Error()
+		return
+	}
+
+	state, err := client.Sys().RaftAutopilotState()
+	if err != nil {
+		status.AutopilotError = err.Error()
+		return
+	}
+	if state == nil {
+		status.AutopilotError = "autopilot not available"
+		return
+	}
+
+	status.AutopilotHealthy = &state.Healthy
+	status.FailureTolerance = state.FailureTolerance
+	status.Leader = state.Leader
+
+	for i := range status.Nodes {
+		n := &status.Nodes[i]
+		for id, server := range state.Servers {
+			if id != n.NodeID && !sameHost(server.Address, n.Address) {
+				continue
+			}
+			if n.NodeID == "" {
+				n.NodeID = id
+			}
+			healthy := server.Healthy
+			n.AutopilotHealthy = &healthy
+			n.AutopilotStatus = server.Status
+			n.LastContact = server.LastContact
+			break
+		}
+	}
+}
+
+// verdict computes the index lag of every node and sums up the cluster state.
+func verdict(status *ClusterStatus, maxLag uint64) {
+	var committed uint64
+	for _, n := range status.Nodes {
+		if n.RaftCommittedIndex > committed {
+			committed = n.RaftCommittedIndex
+		}
+	}
+
+	active := 0
+	critical := false
+	for i := range status.Nodes {
+		n := &status.Nodes[i]
+		name := n.Address
+		if n.NodeID != "" {
+			name = n.NodeID
+		}
+
+		switch {
+		case !n.Reachable:
+			status.Reasons = append(status.Reasons, fmt.Sprintf("%s is unreachable: %s", name, n.Error))
+			continue
+		case !n.Initialized:
+			status.Reasons = append(status.Reasons, fmt.Sprintf("%s is not initialized", name))
+			continue
+		case n.Sealed:
+			status.Reasons = append(status.Reasons, fmt.Sprintf("%s is sealed", name))
+			continue
+		case n.Error != "":
+			status.Reasons = append(status.Reasons, fmt.Sprintf("%s: %s", name, n.Error))
+			continue
+		}
+
+		if n.HAMode == "active" {
+			active++
+			if status.Leader == "" {
+				status.Leader = name
+			}
+		}
+
+		if n.RaftAppliedIndex > 0 && committed > n.RaftAppliedIndex {
+			n.IndexLag = committed - n.RaftAppliedIndex
+		}
+		if n.IndexLag > maxLag {
+			status.Reasons = append(status.Reasons, fmt.Sprintf("%s is %d raft entries behind", name, n.IndexLag))
+		}
+		if n.AutopilotHealthy != nil && !*n.AutopilotHealthy {
+			status.Reasons = append(status.Reasons, fmt.Sprintf("%s is unhealthy for autopilot", name))
+		}
+	}
+
+	switch {
+	case active == 0:
+		critical = true
+		status.Reasons = append(status.Reasons, "no active node")
+	case active > 1:
+		critical = true
+		status.Reasons = append(status.Reasons, fmt.Sprintf("%d active nodes", active))
+	}
+	if status.AutopilotHealthy != nil && !*status.AutopilotHealthy {
+		status.Reasons = append(status.Reasons, "autopilot reports the cluster as unhealthy")
+	}
+
+	switch {
+	case critical:
+		status.Verdict = "critical"
+	case len(status.Reasons) > 0:
+		status.Verdict = "degraded"
+	default:
+		status.Verdict = "healthy"
+	}
+}
+
+func newClient(address, token string) (*vault.Client, error) {
+	conf := vault.DefaultConfig()
+	conf.Address = address
+	conf.Timeout = 10 * time.Second
+	conf.MaxRetries = 0
+
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		client.SetToken(token)
+	}
+	return client, nil
+}
+
+func sameHost(raftAddress, apiAddress string) bool {
+	host, _, err := net.SplitHostPort(raftAddress)
+	if err != nil {
+		host = raftAddress
+	}
+	u, err := url.Parse(apiAddress)
+	if err != nil {
+		return false
+	}
+	return host != "" && host == u.Hostname()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
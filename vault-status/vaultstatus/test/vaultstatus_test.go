@@ -23,6 +23,7 @@ func TestFunc(t *testing.T) {
 	tt := []struct {
 		loglevel    string
 		contentType string
+		nodes       []string
 	}{
 		{
 			loglevel:    "INFO",
@@ -32,6 +33,16 @@ func TestFunc(t *testing.T) {
 			loglevel:    "INFO",
 			contentType: "application/json",
 		},
+		{
+			loglevel:    "INFO",
+			contentType: "text/plain",
+			nodes:       []string{"http://127.0.0.1:8200"},
+		},
+		{
+			loglevel:    "INFO",
+			contentType: "application/json",
+			nodes:       []string{"http://127.0.0.1:8200"},
+		},
 	}
 
 	cli, err := client.NewClientWithOpts()
@@ -52,6 +63,10 @@ func TestFunc(t *testing.T) {
 
 	for _, tr := range tt {
 
+		if len(tr.nodes) != 0 {
+			jsonStruct["nodes"] = tr.nodes
+		}
+
 		jsonBody, _ := json.Marshal(jsonStruct)
 		req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
 		req.Header.Set("Content-Type", tr.contentType)
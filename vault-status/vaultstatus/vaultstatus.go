@@ -15,7 +15,11 @@ import (
 )
 
 type RequestBody struct {
-	Endpoint string `json:"endpoint"`
+	Endpoint    string   `json:"endpoint"`
+	Token       string   `json:"token,omitempty"`
+	Nodes       []string `json:"nodes,omitempty"`
+	Discover    bool     `json:"discover,omitempty"`
+	MaxIndexLag uint64   `json:"maxIndexLag,omitempty"`
 }
 
 type Response struct {
@@ -71,6 +75,11 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(rb.Nodes) != 0 || rb.Discover {
+		serveCluster(w, r, &rb)
+		return
+	}
+
 	if len(rb.Endpoint) == 0 {
 		fmt.Println("empty endpoint")
 		http.Error(w, "empty endpoint", http.StatusBadRequest)
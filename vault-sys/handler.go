@@ -0,0 +1,11 @@
+package function
+
+import (
+	"net/http"
+
+	vaultsys "github.com/efbar/more-serverless/vault-sys/vaultsys"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	vaultsys.Serve(w, r)
+}
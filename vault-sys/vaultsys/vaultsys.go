@@ -0,0 +1,265 @@
+package vaultsys
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/ryanuber/columnize"
+)
+
+type RequestBody struct {
+	Token    string `json:"token"`
+	Endpoint string `json:"endpoint"`
+	Kind     string `json:"kind,omitempty"`
+}
+
+type Mount struct {
+	Path              string            `json:"path"`
+	Type              string            `json:"type"`
+	Accessor          string            `json:"accessor"`
+	Description       string            `json:"description,omitempty"`
+	Version           string            `json:"version,omitempty"`
+	DefaultLeaseTTL   int               `json:"default_lease_ttl"`
+	MaxLeaseTTL       int               `json:"max_lease_ttl"`
+	ForceNoCache      bool              `json:"force_no_cache"`
+	Local             bool              `json:"local"`
+	SealWrap          bool              `json:"seal_wrap"`
+	ListingVisibility string            `json:"listing_visibility,omitempty"`
+	TokenType         string            `json:"token_type,omitempty"`
+	Options           map[string]string `json:"options,omitempty"`
+}
+
+type AuditDevice struct {
+	Path        string            `json:"path"`
+	Type        string            `json:"type"`
+	Description string            `json:"description,omitempty"`
+	Local       bool              `json:"local"`
+	Options     map[string]string `json:"options,omitempty"`
+}
+
+type Inventory struct {
+	Secrets []Mount       `json:"secrets,omitempty"`
+	Auth    []Mount       `json:"auth,omitempty"`
+	Audit   []AuditDevice `json:"audit,omitempty"`
+}
+
+type Response struct {
+	Payload Inventory           `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	switch rb.Kind {
+	case "", "secrets", "auth", "audit":
+	default:
+		fmt.Println("unknown kind:", rb.Kind)
+		http.Error(w, fmt.Sprintf("unknown kind %q, use secrets, auth or audit", rb.Kind), http.StatusBadRequest)
+		return
+	}
+
+	conf := vault.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rb.Token != "" {
+		client.SetToken(rb.Token)
+	}
+
+	inventory := Inventory{}
+
+	if rb.Kind == "" || rb.Kind == "secrets" {
+		mounts, err := client.Sys().ListMounts()
+		if err != nil {
+			fmt.Println("Error listing secrets engines:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		inventory.Secrets = sortedMounts(mounts)
+	}
+
+	if rb.Kind == "" || rb.Kind == "auth" {
+		auths, err := client.Sys().ListAuth()
+		if err != nil {
+			fmt.Println("Error listing auth methods:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		inventory.Auth = sortedMounts(auths)
+	}
+
+	if rb.Kind == "" || rb.Kind == "audit" {
+		audits, err := client.Sys().ListAudit()
+		if err != nil {
+			fmt.Println("Error listing audit devices:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		inventory.Audit = []AuditDevice{}
+		for path, a := range audits {
+			inventory.Audit = append(inventory.Audit, AuditDevice{
+				Path:        path,
+				Type:        a.Type,
+				Description: a.Description,
+				Local:       a.Local,
+				Options:     a.Options,
+			})
+		}
+		sort.Slice(inventory.Audit, func(i, j int) bool {
+			return inventory.Audit[i].Path < inventory.Audit[j].Path
+		})
+	}
+
+	resBody := ""
+	if r.Header.Get("Content-Type") == "text/plain" {
+		out := []string{}
+		if inventory.Secrets != nil {
+			out = append(out, "Secrets Engines:\t\t\t\t\t\t\t\t\t")
+			out = append(out, "Path\tType\tAccessor\tVersion\tDefault TTL\tMax TTL\tLocal\tSeal Wrap\tOptions\tDescription")
+			for _, m := range inventory.Secrets {
+				out = append(out, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%t\t%t\t%s\t%s",
+					m.Path, m.Type, m.Accessor, orNA(m.Version), formatTTL(m.DefaultLeaseTTL), formatTTL(m.MaxLeaseTTL),
+					m.Local, m.SealWrap, formatOptions(m.Options), orNA(m.Description)))
+			}
+			out = append(out, "")
+		}
+		if inventory.Auth != nil {
+			out = append(out, "Auth Methods:\t\t\t\t\t\t\t\t\t")
+			out = append(out, "Path\tType\tAccessor\tToken Type\tDefault TTL\tMax TTL\tLocal\tSeal Wrap\tOptions\tDescription")
+			for _, m := range inventory.Auth {
+				out = append(out, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%t\t%t\t%s\t%s",
+					m.Path, m.Type, m.Accessor, orNA(m.TokenType), formatTTL(m.DefaultLeaseTTL), formatTTL(m.MaxLeaseTTL),
+					m.Local, m.SealWrap, formatOptions(m.Options), orNA(m.Description)))
+			}
+			out = append(out, "")
+		}
+		if inventory.Audit != nil {
+			out = append(out, "Audit Devices:\t\t\t\t\t\t\t\t\t")
+			out = append(out, "Path\tType\tLocal\tOptions\tDescription")
+			for _, a := range inventory.Audit {
+				out = append(out, fmt.Sprintf("%s\t%s\t%t\t%s\t%s",
+					a.Path, a.Type, a.Local, formatOptions(a.Options), orNA(a.Description)))
+			}
+			if len(inventory.Audit) == 0 {
+				out = append(out, "No audit devices are enabled.")
+			}
+		}
+
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "    "
+		columnConf.NoTrim = false
+		resBody = columnize.Format(out, columnConf)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: inventory,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+// sortedMounts flattens secrets engines or auth methods, which share the
+// same output type, sorted by path.
+func sortedMounts(mounts map[string]*vault.MountOutput) []Mount {
+	out := []Mount{}
+	for path, m := range mounts {
+		out = append(out, Mount{
+			Path:              path,
+			Type:              m.Type,
+			Accessor:          m.Accessor,
+			Description:       m.Description,
+			Version:           m.Options["version"],
+			DefaultLeaseTTL:   m.Config.DefaultLeaseTTL,
+			MaxLeaseTTL:       m.Config.MaxLeaseTTL,
+			ForceNoCache:      m.Config.ForceNoCache,
+			Local:             m.Local,
+			SealWrap:          m.SealWrap,
+			ListingVisibility: m.Config.ListingVisibility,
+			TokenType:         m.Config.TokenType,
+			Options:           m.Options,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// formatTTL prints a ttl the way the vault CLI does, 0 meaning the system
+// default.
+func formatTTL(ttl int) string {
+	if ttl == 0 {
+		return "system"
+	}
+	return (time.Duration(ttl) * time.Second).String()
+}
+
+func formatOptions(options map[string]string) string {
+	if len(options) == 0 {
+		return "n/a"
+	}
+	keys := []string{}
+	for k := range options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := []string{}
+	for _, k := range keys {
+		out = append(out, fmt.Sprintf("%s=%s", k, options[k]))
+	}
+	return strings.Join(out, ",")
+}
+
+func orNA(s string) string {
+	if s == "" {
+		return "n/a"
+	}
+	return s
+}
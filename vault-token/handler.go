@@ -0,0 +1,11 @@
+package function
+
+import (
+	"net/http"
+
+	vaulttoken "github.com/efbar/more-serverless/vault-token/vaulttoken"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	vaulttoken.Serve(w, r)
+}
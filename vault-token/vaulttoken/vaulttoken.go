@@ -0,0 +1,310 @@
+package vaulttoken
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	vaultwrap "github.com/efbar/more-serverless/vault-wrap/vaultwrap"
+	vault "github.com/hashicorp/vault/api"
+	"github.com/ryanuber/columnize"
+)
+
+type RequestBody struct {
+	Token           string                 `json:"token"`
+	Endpoint        string                 `json:"endpoint"`
+	Action          string                 `json:"action"`
+	Target          string                 `json:"target,omitempty"`
+	Accessor        string                 `json:"accessor,omitempty"`
+	Policies        []string               `json:"policies,omitempty"`
+	TTL             string                 `json:"ttl,omitempty"`
+	ExplicitMaxTTL  string                 `json:"explicitMaxTtl,omitempty"`
+	Period          string                 `json:"period,omitempty"`
+	Orphan          bool                   `json:"orphan,omitempty"`
+	NoDefaultPolicy bool                   `json:"noDefaultPolicy,omitempty"`
+	Renewable       *bool                  `json:"renewable,omitempty"`
+	DisplayName     string                 `json:"displayName,omitempty"`
+	NumUses         int                    `json:"numUses,omitempty"`
+	Role            string                 `json:"role,omitempty"`
+	Type            string                 `json:"type,omitempty"`
+	Metadata        map[string]string      `json:"metadata,omitempty"`
+	Increment       string                 `json:"increment,omitempty"`
+	Data            map[string]interface{} `json:"data,omitempty"`
+	WrappingToken   string                 `json:"wrappingToken,omitempty"`
+	WrapTTL         string                 `json:"wrapTtl,omitempty"`
+}
+
+type Response struct {
+	Payload map[string]interface{} `json:"payload"`
+	Headers map[string][]string    `json:"headers"`
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+
+	var input []byte
+
+	if r.Body != nil {
+		defer r.Body.Close()
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		input = body
+	}
+
+	rb := RequestBody{}
+	err := json.Unmarshal(input, &rb)
+	if err != nil {
+		fmt.Println("Json parsing error:", err.Error())
+		http.Error(w, "Input data error", http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.Endpoint) == 0 {
+		fmt.Println("empty endpoint")
+		http.Error(w, "empty endpoint", http.StatusBadRequest)
+		return
+	}
+
+	conf := vault.DefaultConfig()
+
+	conf.Address = rb.Endpoint
+
+	client, err := vault.NewClient(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rb.Token != "" {
+		client.SetToken(rb.Token)
+	}
+
+	tokenAuth := client.Auth().Token()
+
+	var payload map[string]interface{}
+	switch rb.Action {
+	case "create":
+		req := &vault.TokenCreateRequest{
+			Policies:        rb.Policies,
+			Metadata:        rb.Metadata,
+			TTL:             rb.TTL,
+			ExplicitMaxTTL:  rb.ExplicitMaxTTL,
+			Period:          rb.Period,
+			NoDefaultPolicy: rb.NoDefaultPolicy,
+			DisplayName:     rb.DisplayName,
+			NumUses:         rb.NumUses,
+			Renewable:       rb.Renewable,
+			Type:            rb.Type,
+		}
+		var secret *vault.Secret
+		switch {
+		case len(rb.Role) != 0:
+			secret, err = tokenAuth.CreateWithRole(req, rb.Role)
+		case rb.Orphan:
+			secret, err = tokenAuth.CreateOrphan(req)
+		default:
+			secret, err = tokenAuth.Create(req)
+		}
+		if err != nil {
+			fmt.Println("Error creating token:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload = authData(secret)
+
+	case "lookup":
+		var secret *vault.Secret
+		switch {
+		case len(rb.Accessor) != 0:
+			secret, err = tokenAuth.LookupAccessor(rb.Accessor)
+		case len(rb.Target) != 0:
+			secret, err = tokenAuth.Lookup(rb.Target)
+		default:
+			secret, err = tokenAuth.LookupSelf()
+		}
+		if err != nil {
+			fmt.Println("Error looking up token:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if secret == nil {
+			fmt.Println("token not found")
+			http.Error(w, "token not found", http.StatusNotFound)
+			return
+		}
+		payload = secret.Data
+
+	case "renew":
+		increment, err := parseIncrement(rb.Increment)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var secret *vault.Secret
+		switch {
+		case len(rb.Accessor) != 0:
+			secret, err = tokenAuth.RenewAccessor(rb.Accessor, increment)
+		case len(rb.Target) != 0:
+			secret, err = tokenAuth.Renew(rb.Target, increment)
+		default:
+			secret, err = tokenAuth.RenewSelf(increment)
+		}
+		if err != nil {
+			fmt.Println("Error renewing token:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload = authData(secret)
+
+	case "revoke":
+		var message string
+		switch {
+		case len(rb.Accessor) != 0:
+			err = tokenAuth.RevokeAccessor(rb.Accessor)
+			message = fmt.Sprintf("Success! Revoked token with accessor %s", rb.Accessor)
+		case len(rb.Target) != 0 && rb.Orphan:
+			err = tokenAuth.RevokeOrphan(rb.Target)
+			message = "Success! Revoked token, its children are now orphans"
+		case len(rb.Target) != 0:
+			err = tokenAuth.RevokeTree(rb.Target)
+			message = "Success! Revoked token and its children"
+		default:
+			fmt.Println("empty target and accessor")
+			http.Error(w, "one of target or accessor is required", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			fmt.Println("Error revoking token:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		payload = map[string]interface{}{"message": message}
+
+	case "wrap":
+		if len(rb.Data) == 0 {
+			fmt.Println("no data")
+			http.Error(w, "no data", http.StatusBadRequest)
+			return
+		}
+		if len(rb.WrapTTL) == 0 {
+			rb.WrapTTL = "5m"
+		}
+		payload = rb.Data
+
+	case "unwrap":
+		if len(rb.WrappingToken) == 0 {
+			fmt.Println("empty wrappingToken")
+			http.Error(w, "empty wrappingToken", http.StatusBadRequest)
+			return
+		}
+		secret, err := client.Logical().Unwrap(rb.WrappingToken)
+		if err != nil {
+			fmt.Println("Error unwrapping:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if secret == nil {
+			fmt.Println("nothing wrapped")
+			http.Error(w, "nothing wrapped", http.StatusNotFound)
+			return
+		}
+		if secret.Auth != nil {
+			payload = authData(secret)
+		} else {
+			payload = secret.Data
+		}
+
+	default:
+		fmt.Println("unknown action:", rb.Action)
+		http.Error(w, fmt.Sprintf("unknown action %q", rb.Action), http.StatusBadRequest)
+		return
+	}
+
+	if len(rb.WrapTTL) != 0 {
+		vaultwrap.Respond(w, r, client, rb.WrapTTL, payload)
+		return
+	}
+
+	resBody := ""
+	if r.Header.Get("Content-Type") == "text/plain" {
+		out := []string{}
+		out = append(out, "Key\tValue")
+		out = append(out, "---\t-----")
+		out = append(out, formatData(payload)...)
+
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "    "
+		columnConf.NoTrim = false
+		resBody = columnize.Format(out, columnConf)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(resBody))
+	} else {
+		jsonResponse := Response{
+			Payload: payload,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+// authData flattens the auth block of a token response the same way
+// `vault token create` prints it.
+func authData(secret *vault.Secret) map[string]interface{} {
+	if secret == nil || secret.Auth == nil {
+		return map[string]interface{}{}
+	}
+	auth := secret.Auth
+	return map[string]interface{}{
+		"token":             auth.ClientToken,
+		"token_accessor":    auth.Accessor,
+		"token_duration":    (time.Duration(auth.LeaseDuration) * time.Second).String(),
+		"token_renewable":   auth.Renewable,
+		"token_policies":    auth.TokenPolicies,
+		"identity_policies": auth.IdentityPolicies,
+		"policies":          auth.Policies,
+		"orphan":            auth.Orphan,
+		"metadata":          auth.Metadata,
+	}
+}
+
+// parseIncrement accepts either a number of seconds or a duration string.
+func parseIncrement(increment string) (int, error) {
+	if len(increment) == 0 {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(increment); err == nil {
+		return seconds, nil
+	}
+	d, err := time.ParseDuration(increment)
+	if err != nil {
+		return 0, fmt.Errorf("invalid increment %q", increment)
+	}
+	return int(d.Seconds()), nil
+}
+
+func formatData(rawData map[string]interface{}) []string {
+	keys := []string{}
+	for k := range rawData {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := []string{}
+	for _, k := range keys {
+		out = append(out, fmt.Sprintf("%s\t%v", k, rawData[k]))
+	}
+	return out
+}
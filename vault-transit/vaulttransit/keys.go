@@ -0,0 +1,359 @@
+package vaulttransit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	vaultwrap "github.com/efbar/more-serverless/vault-wrap/vaultwrap"
+	vault "github.com/hashicorp/vault/api"
+	"github.com/ryanuber/columnize"
+)
+
+// KeyConfig carries the parameters of the key lifecycle actions.
+type KeyConfig struct {
+	MinDecryptionVersion *int   `json:"min_decryption_version,omitempty"`
+	MinEncryptionVersion *int   `json:"min_encryption_version,omitempty"`
+	MinAvailableVersion  int    `json:"min_available_version,omitempty"`
+	DeletionAllowed      *bool  `json:"deletion_allowed,omitempty"`
+	Exportable           *bool  `json:"exportable,omitempty"`
+	AllowPlaintextBackup *bool  `json:"allow_plaintext_backup,omitempty"`
+	AutoRotatePeriod     string `json:"auto_rotate_period,omitempty"`
+	Backup               string `json:"backup,omitempty"`
+	Force                bool   `json:"force,omitempty"`
+}
+
+type KeyVersion struct {
+	Version   int    `json:"version"`
+	CreatedAt string `json:"created_at"`
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+type KeyInfo struct {
+	Name                 string       `json:"name"`
+	Type                 string       `json:"type"`
+	LatestVersion        int          `json:"latest_version"`
+	MinDecryptionVersion int          `json:"min_decryption_version"`
+	MinEncryptionVersion int          `json:"min_encryption_version"`
+	MinAvailableVersion  int          `json:"min_available_version"`
+	DeletionAllowed      bool         `json:"deletion_allowed"`
+	Exportable           bool         `json:"exportable"`
+	AllowPlaintextBackup bool         `json:"allow_plaintext_backup"`
+	AutoRotatePeriod     string       `json:"auto_rotate_period,omitempty"`
+	SupportsEncryption   bool         `json:"supports_encryption"`
+	SupportsDecryption   bool         `json:"supports_decryption"`
+	SupportsSigning      bool         `json:"supports_signing"`
+	Versions             []KeyVersion `json:"versions"`
+}
+
+type KeyResult struct {
+	Keys    []string `json:"keys,omitempty"`
+	Key     *KeyInfo `json:"key,omitempty"`
+	Backup  string   `json:"backup,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+var keyOperations = map[string]bool{
+	"list-keys":   true,
+	"read-key":    true,
+	"create-key":  true,
+	"rotate-key":  true,
+	"config-key":  true,
+	"trim-key":    true,
+	"delete-key":  true,
+	"backup-key":  true,
+	"restore-key": true,
+}
+
+func transitMount(mount string) string {
+	mount = strings.Trim(mount, "/")
+	if mount == "" {
+		return defaultMount
+	}
+	return mount
+}
+
+func serveKeyOperation(w http.ResponseWriter, r *http.Request, client *vault.Client, rb *RequestBody) {
+	mount := transitMount(rb.Mount)
+
+	if rb.Operation != "list-keys" && rb.Key == "" {
+		fmt.Println("empty key")
+		http.Error(w, "empty key", http.StatusBadRequest)
+		return
+	}
+
+	res, err := keyOperation(client, mount, rb)
+	if err != nil {
+		fmt.Printf("Error running %s on %s: %s\n", rb.Operation, mount, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(rb.WrapTTL) != 0 {
+		vaultwrap.Respond(w, r, client, rb.WrapTTL, res)
+		return
+	}
+
+	if r.Header.Get("Content-Type") == "text/plain" {
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "    "
+		columnConf.NoTrim = false
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(columnize.Format(formatKeyResult(res), columnConf)))
+	} else {
+		jsonResponse := Response{
+			Payload: res,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+func keyOperation(client *vault.Client, mount string, rb *RequestBody) (*KeyResult, error) {
+	keyPath := fmt.Sprintf("%s/keys/%s", mount, rb.Key)
+
+	switch rb.Operation {
+	case "list-keys":
+		secret, err := client.Logical().List(mount + "/keys")
+		if err != nil {
+			return nil, err
+		}
+		res := &KeyResult{Keys: []string{}}
+		if secret != nil {
+			if keys, ok := secret.Data["keys"].([]interface{}); ok {
+				for _, k := range keys {
+					res.Keys = append(res.Keys, stringValue(k))
+				}
+			}
+		}
+		sort.Strings(res.Keys)
+		return res, nil
+
+	case "read-key":
+		return readKey(client, mount, rb.Key)
+
+	case "create-key":
+		data := map[string]interface{}{}
+		if rb.Type != "" {
+			data["type"] = rb.Type
+		}
+		if rb.Exportable != nil {
+			data["exportable"] = *rb.Exportable
+		}
+		if rb.AllowPlaintextBackup != nil {
+			data["allow_plaintext_backup"] = *rb.AllowPlaintextBackup
+		}
+		if rb.AutoRotatePeriod != "" {
+			data["auto_rotate_period"] = rb.AutoRotatePeriod
+		}
+		if _, err := client.Logical().Write(keyPath, data); err != nil {
+			return nil, err
+		}
+		return readKey(client, mount, rb.Key)
+
+	case "rotate-key":
+		if _, err := client.Logical().Write(keyPath+"/rotate", nil); err != nil {
+			return nil, err
+		}
+		return readKey(client, mount, rb.Key)
+
+	case "config-key":
+		data := map[string]interface{}{}
+		if rb.MinDecryptionVersion != nil {
+			data["min_decryption_version"] = *rb.MinDecryptionVersion
+		}
+		if rb.MinEncryptionVersion != nil {
+			data["min_encryption_version"] = *rb.MinEncryptionVersion
+		}
+		if rb.DeletionAllowed != nil {
+			data["deletion_allowed"] = *rb.DeletionAllowed
+		}
+		if rb.Exportable != nil {
+			data["exportable"] = *rb.Exportable
+		}
+		if rb.AllowPlaintextBackup != nil {
+			data["allow_plaintext_backup"] = *rb.AllowPlaintextBackup
+		}
+		if rb.AutoRotatePeriod != "" {
+			data["auto_rotate_period"] = rb.AutoRotatePeriod
+		}
+		if len(data) == 0 {
+			return nil, fmt.Errorf("no configuration supplied")
+		}
+		if _, err := client.Logical().Write(keyPath+"/config", data); err != nil {
+			return nil, err
+		}
+		return readKey(client, mount, rb.Key)
+
+	case "trim-key":
+		if rb.MinAvailableVersion <= 0 {
+			return nil, fmt.Errorf("min_available_version must be greater than zero")
+		}
+		data := map[string]interface{}{
+			"min_available_version": rb.MinAvailableVersion,
+		}
+		if _, err := client.Logical().Write(keyPath+"/trim", data); err != nil {
+			return nil, err
+		}
+		return readKey(client, mount, rb.Key)
+
+	case "delete-key":
+		if _, err := client.Logical().Delete(keyPath); err != nil {
+			return nil, err
+		}
+		return &KeyResult{Message: fmt.Sprintf("Success! Deleted key %s", rb.Key)}, nil
+
+	case "backup-key":
+		secret, err := client.Logical().Read(fmt.Sprintf("%s/backup/%s", mount, rb.Key))
+		if err != nil {
+			return nil, err
+		}
+		if secret == nil {
+			return nil, fmt.Errorf("no backup returned for key %s", rb.Key)
+		}
+		return &KeyResult{Backup: stringValue(secret.Data["backup"])}, nil
+
+	case "restore-key":
+		if rb.Backup == "" {
+			return nil, fmt.Errorf("empty backup")
+		}
+		data := map[string]interface{}{
+			"backup": rb.Backup,
+			"force":  rb.Force,
+		}
+		if _, err := client.Logical().Write(fmt.Sprintf("%s/restore/%s", mount, rb.Key), data); err != nil {
+			return nil, err
+		}
+		return readKey(client, mount, rb.Key)
+	}
+
+	return nil, fmt.Errorf("unknown operation %q", rb.Operation)
+}
+
+func readKey(client *vault.Client, mount, name string) (*KeyResult, error) {
+	secret, err := client.Logical().Read(fmt.Sprintf("%s/keys/%s", mount, name))
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("key %s not found", name)
+	}
+
+	data := secret.Data
+	info := &KeyInfo{
+		Name:                 stringValue(data["name"]),
+		Type:                 stringValue(data["type"]),
+		LatestVersion:        intValue(data["latest_version"]),
+		MinDecryptionVersion: intValue(data["min_decryption_version"]),
+		MinEncryptionVersion: intValue(data["min_encryption_version"]),
+		MinAvailableVersion:  intValue(data["min_available_version"]),
+		SupportsEncryption:   boolValue(data["supports_encryption"]),
+		SupportsDecryption:   boolValue(data["supports_decryption"]),
+		SupportsSigning:      boolValue(data["supports_signing"]),
+		DeletionAllowed:      boolValue(data["deletion_allowed"]),
+		Exportable:           boolValue(data["exportable"]),
+		AllowPlaintextBackup: boolValue(data["allow_plaintext_backup"]),
+		Versions:             []KeyVersion{},
+	}
+	if period := intValue(data["auto_rotate_period"]); period > 0 {
+		info.AutoRotatePeriod = (time.Duration(period) * time.Second).String()
+	}
+
+	// Symmetric keys report a creation timestamp per version, asymmetric
+	// keys an object with the creation time and the public key.
+	if keys, ok := data["keys"].(map[string]interface{}); ok {
+		for k, v := range keys {
+			version, err := strconv.Atoi(k)
+			if err != nil {
+				continue
+			}
+			kv := KeyVersion{Version: version}
+			switch val := v.(type) {
+			case map[string]interface{}:
+				kv.CreatedAt = stringValue(val["creation_time"])
+				kv.PublicKey = stringValue(val["public_key"])
+			default:
+				if ts := intValue(val); ts > 0 {
+					kv.CreatedAt = time.Unix(int64(ts), 0).UTC().Format(time.RFC3339)
+				}
+			}
+			info.Versions = append(info.Versions, kv)
+		}
+	}
+	sort.Slice(info.Versions, func(i, j int) bool {
+		return info.Versions[i].Version < info.Versions[j].Version
+	})
+
+	return &KeyResult{Key: info}, nil
+}
+
+func formatKeyResult(res *KeyResult) []string {
+	out := []string{}
+
+	switch {
+	case res.Keys != nil:
+		out = append(out, "Keys")
+		out = append(out, "----")
+		out = append(out, res.Keys...)
+	case res.Key != nil:
+		k := res.Key
+		out = append(out, "Key\tValue")
+		out = append(out, "---\t-----")
+		out = append(out, fmt.Sprintf("name\t%s", k.Name))
+		out = append(out, fmt.Sprintf("type\t%s", k.Type))
+		out = append(out, fmt.Sprintf("latest_version\t%d", k.LatestVersion))
+		out = append(out, fmt.Sprintf("min_decryption_version\t%d", k.MinDecryptionVersion))
+		out = append(out, fmt.Sprintf("min_encryption_version\t%d", k.MinEncryptionVersion))
+		out = append(out, fmt.Sprintf("min_available_version\t%d", k.MinAvailableVersion))
+		out = append(out, fmt.Sprintf("deletion_allowed\t%t", k.DeletionAllowed))
+		out = append(out, fmt.Sprintf("exportable\t%t", k.Exportable))
+		out = append(out, fmt.Sprintf("allow_plaintext_backup\t%t", k.AllowPlaintextBackup))
+		if k.AutoRotatePeriod != "" {
+			out = append(out, fmt.Sprintf("auto_rotate_period\t%s", k.AutoRotatePeriod))
+		}
+		out = append(out, "")
+		out = append(out, "Version\tCreated\tStatus")
+		out = append(out, "-------\t-------\t------")
+		for _, v := range k.Versions {
+			out = append(out, fmt.Sprintf("%d\t%s\t%s", v.Version, v.CreatedAt, versionStatus(k, v.Version)))
+		}
+	case res.Backup != "":
+		out = append(out, "Key\tValue")
+		out = append(out, "---\t-----")
+		out = append(out, fmt.Sprintf("backup\t%s", res.Backup))
+	default:
+		out = append(out, res.Message)
+	}
+
+	return out
+}
+
+// versionStatus tells whether a key version can still be used to encrypt
+// and decrypt, given the key configuration.
+func versionStatus(k *KeyInfo, version int) string {
+	switch {
+	case version < k.MinDecryptionVersion:
+		return "disabled"
+	case k.MinEncryptionVersion > 0 && version < k.MinEncryptionVersion:
+		return "decrypt only"
+	case version == k.LatestVersion:
+		return "latest"
+	}
+	return "active"
+}
+
+func boolValue(v interface{}) bool {
+	b, _ := v.(bool)
+	return b
+}
@@ -0,0 +1,312 @@
+package vaulttransit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+const defaultMount = "transit"
+
+// OperationInput carries the typed parameters of a transit operation. The same
+// struct is used for every element of batch_input.
+type OperationInput struct {
+	Plaintext          string           `json:"plaintext,omitempty"`
+	Ciphertext         string           `json:"ciphertext,omitempty"`
+	Context            string           `json:"context,omitempty"`
+	Nonce              string           `json:"nonce,omitempty"`
+	KeyVersion         int              `json:"key_version,omitempty"`
+	Input              string           `json:"input,omitempty"`
+	Signature          string           `json:"signature,omitempty"`
+	HMAC               string           `json:"hmac,omitempty"`
+	HashAlgorithm      string           `json:"hash_algorithm,omitempty"`
+	SignatureAlgorithm string           `json:"signature_algorithm,omitempty"`
+	Prehashed          bool             `json:"prehashed,omitempty"`
+	Type               string           `json:"type,omitempty"`
+	Bits               int              `json:"bits,omitempty"`
+	Bytes              int              `json:"bytes,omitempty"`
+	Format             string           `json:"format,omitempty"`
+	BatchInput         []OperationInput `json:"batch_input,omitempty"`
+}
+
+// OperationResult is the typed output of a transit operation.
+type OperationResult struct {
+	Ciphertext   string            `json:"ciphertext,omitempty"`
+	Plaintext    string            `json:"plaintext,omitempty"`
+	KeyVersion   int               `json:"key_version,omitempty"`
+	Signature    string            `json:"signature,omitempty"`
+	HMAC         string            `json:"hmac,omitempty"`
+	Valid        *bool             `json:"valid,omitempty"`
+	RandomBytes  string            `json:"random_bytes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	BatchResults []OperationResult `json:"batch_results,omitempty"`
+}
+
+var operations = map[string]bool{
+	"encrypt": true,
+	"decrypt": true,
+	"rewrap":  true,
+	"sign":    true,
+	"verify":  true,
+	"hmac":    true,
+	"datakey": true,
+	"random":  true,
+}
+
+func operationPath(rb *RequestBody) (string, error) {
+	mount := transitMount(rb.Mount)
+
+	if rb.Operation == "random" {
+		return mount + "/random", nil
+	}
+
+	if rb.Key == "" {
+		return "", fmt.Errorf("empty key")
+	}
+
+	switch rb.Operation {
+	case "encrypt", "decrypt", "rewrap":
+		return fmt.Sprintf("%s/%s/%s", mount, rb.Operation, rb.Key), nil
+	case "sign", "verify":
+		if rb.HashAlgorithm != "" {
+			return fmt.Sprintf("%s/%s/%s/%s", mount, rb.Operation, rb.Key, rb.HashAlgorithm), nil
+		}
+		return fmt.Sprintf("%s/%s/%s", mount, rb.Operation, rb.Key), nil
+	case "hmac":
+		if rb.HashAlgorithm != "" {
+			return fmt.Sprintf("%s/hmac/%s/%s", mount, rb.Key, rb.HashAlgorithm), nil
+		}
+		return fmt.Sprintf("%s/hmac/%s", mount, rb.Key), nil
+	case "datakey":
+		keyType := rb.Type
+		if keyType == "" {
+			keyType = "wrapped"
+		}
+		if keyType != "wrapped" && keyType != "plaintext" {
+			return "", fmt.Errorf("datakey type must be plaintext or wrapped, got %q", keyType)
+		}
+		return fmt.Sprintf("%s/datakey/%s/%s", mount, keyType, rb.Key), nil
+	}
+
+	return "", fmt.Errorf("unknown operation %q", rb.Operation)
+}
+
+// operationData builds the request body for the given operation. Plaintext,
+// input and context values are base64 encoded unless the caller says they
+// already are.
+func operationData(operation string, in *OperationInput, encoded bool) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+
+	if len(in.BatchInput) > 0 {
+		batch := []map[string]interface{}{}
+		for i := range in.BatchInput {
+			item, err := operationItem(operation, &in.BatchInput[i], encoded)
+			if err != nil {
+				return nil, fmt.Errorf("batch_input[%d]: %s", i, err)
+			}
+			batch = append(batch, item)
+		}
+		data["batch_input"] = batch
+	} else if operation != "datakey" && operation != "random" {
+		item, err := operationItem(operation, in, encoded)
+		if err != nil {
+			return nil, err
+		}
+		data = item
+	}
+
+	switch operation {
+	case "encrypt", "rewrap", "sign", "hmac":
+		if in.KeyVersion > 0 {
+			data["key_version"] = in.KeyVersion
+		}
+	case "datakey":
+		if in.Context != "" {
+			data["context"] = encode(in.Context, encoded)
+		}
+		if in.Nonce != "" {
+			data["nonce"] = in.Nonce
+		}
+		if in.Bits > 0 {
+			data["bits"] = in.Bits
+		}
+	case "random":
+		if in.Bytes > 0 {
+			data["bytes"] = in.Bytes
+		}
+		if in.Format != "" {
+			data["format"] = in.Format
+		}
+	}
+
+	if operation == "sign" || operation == "verify" {
+		if in.SignatureAlgorithm != "" {
+			data["signature_algorithm"] = in.SignatureAlgorithm
+		}
+		if in.Prehashed {
+			data["prehashed"] = true
+		}
+	}
+
+	return data, nil
+}
+
+func operationItem(operation string, in *OperationInput, encoded bool) (map[string]interface{}, error) {
+	item := map[string]interface{}{}
+
+	if in.Context != "" {
+		item["context"] = encode(in.Context, encoded)
+	}
+
+	switch operation {
+	case "encrypt":
+		if in.Plaintext == "" {
+			return nil, fmt.Errorf("empty plaintext")
+		}
+		item["plaintext"] = encode(in.Plaintext, encoded)
+		if in.Nonce != "" {
+			item["nonce"] = in.Nonce
+		}
+		if in.KeyVersion > 0 {
+			item["key_version"] = in.KeyVersion
+		}
+	case "decrypt", "rewrap":
+		if in.Ciphertext == "" {
+			return nil, fmt.Errorf("empty ciphertext")
+		}
+		item["ciphertext"] = in.Ciphertext
+		if in.Nonce != "" {
+			item["nonce"] = in.Nonce
+		}
+	case "sign", "hmac":
+		if in.Input == "" {
+			return nil, fmt.Errorf("empty input")
+		}
+		item["input"] = encode(in.Input, encoded)
+	case "verify":
+		if in.Input == "" {
+			return nil, fmt.Errorf("empty input")
+		}
+		item["input"] = encode(in.Input, encoded)
+		if in.Signature != "" {
+			item["signature"] = in.Signature
+		} else if in.HMAC != "" {
+			item["hmac"] = in.HMAC
+		} else {
+			return nil, fmt.Errorf("one of signature or hmac is required")
+		}
+	}
+
+	return item, nil
+}
+
+// operationResult maps the response data of a transit call to an
+// OperationResult, decoding plaintext unless the caller asked for it encoded.
+func operationResult(operation string, secret *vault.Secret, encoded bool) OperationResult {
+	res := OperationResult{}
+	if secret == nil {
+		return res
+	}
+
+	if batch, ok := secret.Data["batch_results"].([]interface{}); ok {
+		for _, v := range batch {
+			item, _ := v.(map[string]interface{})
+			res.BatchResults = append(res.BatchResults, resultFromData(operation, item, encoded))
+		}
+		return res
+	}
+
+	return resultFromData(operation, secret.Data, encoded)
+}
+
+func resultFromData(operation string, data map[string]interface{}, encoded bool) OperationResult {
+	res := OperationResult{
+		Ciphertext:  stringValue(data["ciphertext"]),
+		Signature:   stringValue(data["signature"]),
+		HMAC:        stringValue(data["hmac"]),
+		RandomBytes: stringValue(data["random_bytes"]),
+		Error:       stringValue(data["error"]),
+		KeyVersion:  intValue(data["key_version"]),
+	}
+
+	if valid, ok := data["valid"].(bool); ok {
+		res.Valid = &valid
+	}
+
+	plaintext := stringValue(data["plaintext"])
+	if operation == "decrypt" && !encoded && plaintext != "" {
+		decoded, err := base64.StdEncoding.DecodeString(plaintext)
+		if err == nil {
+			plaintext = string(decoded)
+		}
+	}
+	res.Plaintext = plaintext
+
+	return res
+}
+
+func formatResult(res OperationResult) []string {
+	out := []string{}
+	if len(res.BatchResults) > 0 {
+		for i, v := range res.BatchResults {
+			for _, line := range formatResult(v) {
+				out = append(out, fmt.Sprintf("[%d] %s", i, line))
+			}
+		}
+		return out
+	}
+
+	if res.Ciphertext != "" {
+		out = append(out, fmt.Sprintf("ciphertext\t%s", res.Ciphertext))
+	}
+	if res.Plaintext != "" {
+		out = append(out, fmt.Sprintf("plaintext\t%s", res.Plaintext))
+	}
+	if res.Signature != "" {
+		out = append(out, fmt.Sprintf("signature\t%s", res.Signature))
+	}
+	if res.HMAC != "" {
+		out = append(out, fmt.Sprintf("hmac\t%s", res.HMAC))
+	}
+	if res.Valid != nil {
+		out = append(out, fmt.Sprintf("valid\t%t", *res.Valid))
+	}
+	if res.RandomBytes != "" {
+		out = append(out, fmt.Sprintf("random_bytes\t%s", res.RandomBytes))
+	}
+	if res.KeyVersion > 0 {
+		out = append(out, fmt.Sprintf("key_version\t%d", res.KeyVersion))
+	}
+	if res.Error != "" {
+		out = append(out, fmt.Sprintf("error\t%s", res.Error))
+	}
+	return out
+}
+
+func encode(value string, encoded bool) string {
+	if encoded {
+		return value
+	}
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func intValue(v interface{}) int {
+	switch n := v.(type) {
+	case json.Number:
+		i, _ := strconv.Atoi(n.String())
+		return i
+	case float64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
@@ -27,6 +27,7 @@ func TestFunc(t *testing.T) {
 	tt := []struct {
 		contentType string
 		action      string
+		operation   bool
 	}{
 		{
 			contentType: "text/plain",
@@ -36,6 +37,46 @@ func TestFunc(t *testing.T) {
 			contentType: "application/json",
 			action:      "decrypt",
 		},
+		{
+			contentType: "text/plain",
+			action:      "encrypt",
+			operation:   true,
+		},
+		{
+			contentType: "application/json",
+			action:      "decrypt",
+			operation:   true,
+		},
+		{
+			contentType: "application/json",
+			action:      "hmac",
+			operation:   true,
+		},
+		{
+			contentType: "text/plain",
+			action:      "rotate-key",
+			operation:   true,
+		},
+		{
+			contentType: "application/json",
+			action:      "config-key",
+			operation:   true,
+		},
+		{
+			contentType: "text/plain",
+			action:      "read-key",
+			operation:   true,
+		},
+		{
+			contentType: "text/plain",
+			action:      "list-keys",
+			operation:   true,
+		},
+		{
+			contentType: "application/json",
+			action:      "backup-key",
+			operation:   true,
+		},
 	}
 
 	cli, err := client.NewClientWithOpts()
@@ -118,6 +159,31 @@ func TestFunc(t *testing.T) {
 			"data":     data,
 		}
 
+		if tr.operation {
+			jsonStruct = map[string]interface{}{
+				"endpoint":  "http://127.0.0.1:" + vaultServerPort,
+				"token":     "root",
+				"operation": tr.action,
+				"key":       "testkey",
+			}
+			switch tr.action {
+			case "encrypt":
+				jsonStruct["batch_input"] = []map[string]interface{}{
+					{"plaintext": "foo"},
+					{"plaintext": "bar"},
+				}
+			case "decrypt":
+				jsonStruct["ciphertext"] = data["ciphertext"]
+			case "hmac":
+				jsonStruct["input"] = "foobar"
+			case "config-key":
+				jsonStruct["min_decryption_version"] = 2
+				jsonStruct["deletion_allowed"] = true
+				jsonStruct["exportable"] = true
+				jsonStruct["allow_plaintext_backup"] = true
+			}
+		}
+
 		jsonBody, _ := json.Marshal(jsonStruct)
 		req := httptest.NewRequest("GET", "/", bytes.NewReader(jsonBody))
 		req.Header.Set("Content-Type", tr.contentType)
@@ -7,20 +7,28 @@ import (
 	"net/http"
 	"strings"
 
+	vaultwrap "github.com/efbar/more-serverless/vault-wrap/vaultwrap"
 	vault "github.com/hashicorp/vault/api"
 	"github.com/ryanuber/columnize"
 )
 
 type RequestBody struct {
-	Token    string                 `json:"token"`
-	Endpoint string                 `json:"endpoint"`
-	Path     string                 `json:"path"`
-	Data     map[string]interface{} `json:"data"`
+	Token     string                 `json:"token"`
+	Endpoint  string                 `json:"endpoint"`
+	Path      string                 `json:"path,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Operation string                 `json:"operation,omitempty"`
+	Mount     string                 `json:"mount,omitempty"`
+	Key       string                 `json:"key,omitempty"`
+	Encoded   bool                   `json:"encoded,omitempty"`
+	WrapTTL   string                 `json:"wrapTtl,omitempty"`
+	OperationInput
+	KeyConfig
 }
 
 type Response struct {
-	Payload map[string]interface{} `json:"payload"`
-	Headers map[string][]string    `json:"headers"`
+	Payload interface{}         `json:"payload"`
+	Headers map[string][]string `json:"headers"`
 }
 
 func Serve(w http.ResponseWriter, r *http.Request) {
@@ -64,6 +72,16 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 		client.SetToken(rb.Token)
 	}
 
+	if keyOperations[rb.Operation] {
+		serveKeyOperation(w, r, client, &rb)
+		return
+	}
+
+	if len(rb.Operation) != 0 {
+		serveOperation(w, r, client, &rb)
+		return
+	}
+
 	path := rb.Path
 	if len(path) == 0 {
 		fmt.Println("empty path")
@@ -73,10 +91,8 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 
 	data := rb.Data
 
-	subpaths := strings.Split(path, "/")
-
 	var secret *vault.Secret
-	if len(data) == 0 && subpaths[len(subpaths)-1] != "rotate" && subpaths[1] != "keys" {
+	if len(data) == 0 && !dataless(path) {
 		fmt.Println("no data")
 		http.Error(w, "No data supplied", http.StatusInternalServerError)
 		return
@@ -95,6 +111,11 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 	}
 	resData := secret.Data
 
+	if len(rb.WrapTTL) != 0 {
+		vaultwrap.Respond(w, r, client, rb.WrapTTL, resData)
+		return
+	}
+
 	resBody := ""
 	if r.Header.Get("Content-Type") == "text/plain" {
 		out := []string{}
@@ -125,6 +146,79 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func serveOperation(w http.ResponseWriter, r *http.Request, client *vault.Client, rb *RequestBody) {
+	if !operations[rb.Operation] {
+		fmt.Println("unknown operation:", rb.Operation)
+		http.Error(w, fmt.Sprintf("unknown operation %q", rb.Operation), http.StatusBadRequest)
+		return
+	}
+
+	path, err := operationPath(rb)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := operationData(rb.Operation, &rb.OperationInput, rb.Encoded)
+	if err != nil {
+		fmt.Println(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret, err := client.Logical().Write(path, data)
+	if err != nil {
+		fmt.Printf("Error writing data to %s: %s", path, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := operationResult(rb.Operation, secret, rb.Encoded)
+
+	if len(rb.WrapTTL) != 0 {
+		vaultwrap.Respond(w, r, client, rb.WrapTTL, res)
+		return
+	}
+
+	if r.Header.Get("Content-Type") == "text/plain" {
+		out := []string{}
+		out = append(out, "Key\tValue")
+		out = append(out, "---\t-----")
+		out = append(out, formatResult(res)...)
+		out = append(out, "")
+
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = ""
+		columnConf.NoTrim = false
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(columnize.Format(out, columnConf)))
+	} else {
+		jsonResponse := Response{
+			Payload: res,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}
+
+// dataless reports whether a raw path can be written without a body, which
+// is the case for key creation and rotation.
+func dataless(path string) bool {
+	subpaths := strings.Split(strings.Trim(path, "/"), "/")
+	if subpaths[len(subpaths)-1] == "rotate" {
+		return true
+	}
+	return len(subpaths) >= 3 && subpaths[len(subpaths)-2] == "keys"
+}
+
 func formatData(rawData map[string]interface{}) []string {
 	out := []string{}
 	if len(rawData) > 0 {
@@ -0,0 +1,8 @@
+module github.com/efbar/more-serverless/vault-wrap/vaultwrap
+
+go 1.16
+
+require (
+	github.com/hashicorp/vault/api v1.1.0
+	github.com/ryanuber/columnize v2.1.2+incompatible
+)
@@ -0,0 +1,105 @@
+// Package vaultwrap response-wraps the payload of the Vault functions that
+// accept "wrapTtl", so that only a single-use wrapping token is returned.
+package vaultwrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/ryanuber/columnize"
+)
+
+type Info struct {
+	Token           string `json:"token"`
+	Accessor        string `json:"accessor"`
+	TTL             int    `json:"ttl"`
+	CreationTime    string `json:"creation_time"`
+	CreationPath    string `json:"creation_path"`
+	WrappedAccessor string `json:"wrapped_accessor,omitempty"`
+}
+
+type Response struct {
+	Payload Info                `json:"payload"`
+	Headers map[string][]string `json:"headers"`
+}
+
+// Wrap hands the payload to sys/wrapping/wrap, so that it can be read only
+// once by whoever holds the returned wrapping token.
+func Wrap(client *vault.Client, ttl string, payload interface{}) (*vault.SecretWrapInfo, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+
+	client.SetWrappingLookupFunc(func(operation, path string) string {
+		return ttl
+	})
+	defer client.SetWrappingLookupFunc(nil)
+
+	secret, err := client.Logical().Write("sys/wrapping/wrap", data)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.WrapInfo == nil {
+		return nil, fmt.Errorf("no wrapping information returned")
+	}
+	return secret.WrapInfo, nil
+}
+
+// Respond wraps the payload and writes the wrapping token as the response,
+// as text if the request Content-Type is text/plain, as json otherwise.
+func Respond(w http.ResponseWriter, r *http.Request, client *vault.Client, ttl string, payload interface{}) {
+	wrapInfo, err := Wrap(client, ttl, payload)
+	if err != nil {
+		fmt.Println("Error wrapping response:", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	info := Info{
+		Token:           wrapInfo.Token,
+		Accessor:        wrapInfo.Accessor,
+		TTL:             wrapInfo.TTL,
+		CreationTime:    wrapInfo.CreationTime.Format(time.RFC3339Nano),
+		CreationPath:    wrapInfo.CreationPath,
+		WrappedAccessor: wrapInfo.WrappedAccessor,
+	}
+
+	if r.Header.Get("Content-Type") == "text/plain" {
+		out := []string{"Key\tValue", "---\t-----"}
+		out = append(out, fmt.Sprintf("wrapping_token\t%s", info.Token))
+		out = append(out, fmt.Sprintf("wrapping_accessor\t%s", info.Accessor))
+		out = append(out, fmt.Sprintf("wrapping_token_ttl\t%s", time.Duration(info.TTL)*time.Second))
+		out = append(out, fmt.Sprintf("wrapping_token_creation_time\t%s", info.CreationTime))
+		out = append(out, fmt.Sprintf("wrapping_token_creation_path\t%s", info.CreationPath))
+		if len(info.WrappedAccessor) != 0 {
+			out = append(out, fmt.Sprintf("wrapped_accessor\t%s", info.WrappedAccessor))
+		}
+
+		columnConf := columnize.DefaultConfig()
+		columnConf.Delim = "\t"
+		columnConf.Glue = "    "
+		columnConf.NoTrim = false
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(columnize.Format(out, columnConf)))
+	} else {
+		jsonResponse := Response{
+			Payload: info,
+			Headers: r.Header,
+		}
+		resBody, err := json.Marshal(jsonResponse)
+		if err != nil {
+			fmt.Println(err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resBody)
+	}
+}